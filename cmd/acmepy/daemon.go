@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"9fans.net/go/plan9/client"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// pidFile returns the name of the file locked by the running acmepy.
+// There is one per name space, as there is one acme.
+func pidFile() string {
+	if *pidFlag != "" {
+		return *pidFlag
+	}
+	return filepath.Join(client.Namespace(), "acmepy.pid")
+}
+
+// waitForAcme returns once acme can be reached, trying again with
+// exponential backoff until it can.
+func waitForAcme() {
+	delay := minBackoff
+	for {
+		c, err := client.DialService("acme")
+		if err == nil {
+			c.Close()
+			return
+		}
+		if delay == minBackoff {
+			log.Printf("waiting for acme: %v", err)
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+}
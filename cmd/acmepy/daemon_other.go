@@ -0,0 +1,14 @@
+//go:build plan9 || windows
+// +build plan9 windows
+
+package main
+
+import "errors"
+
+func lockPidFile(name string) (unlock func(), err error) {
+	return func() {}, nil
+}
+
+func restart() error {
+	return errors.New("cannot restart on this system")
+}
@@ -0,0 +1,92 @@
+//go:build !plan9 && !windows
+// +build !plan9,!windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockFdEnv is the environment variable giving a restarted acmepy the
+// descriptor of the pid file, still locked.
+const lockFdEnv = "ACMEPY_LOCK_FD"
+
+// pidLock is the locked pid file, kept open across restarts so that
+// no other acmepy can start in between.
+var pidLock *os.File
+
+// lockPidFile locks the named file and writes the process ID to it,
+// so that only one acmepy runs at a time. After a restart, it takes
+// over the lock held before. It returns a function that removes the
+// file.
+func lockPidFile(name string) (unlock func(), err error) {
+	unlock = func() {
+		os.Remove(name)
+		pidLock.Close()
+	}
+	if s := os.Getenv(lockFdEnv); s != "" {
+		os.Unsetenv(lockFdEnv)
+		if fd, err := strconv.Atoi(s); err == nil {
+			syscall.CloseOnExec(fd)
+			f := os.NewFile(uintptr(fd), name)
+			// The lock belongs to the open file, so taking it again
+			// succeeds only if it is still ours.
+			if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+				pidLock = f
+				return unlock, nil
+			}
+			f.Close()
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			pid, _ := ioutil.ReadFile(name)
+			return nil, fmt.Errorf("already running as process %s (lock file %s)", strings.TrimSpace(string(pid)), name)
+		}
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	pidLock = f
+	return unlock, nil
+}
+
+// restart replaces the process with a new acmepy, started with the
+// same arguments, handing it the locked pid file. It only returns if
+// that fails.
+func restart() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := os.Environ()
+	if pidLock != nil {
+		fd := pidLock.Fd()
+		if _, _, e := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); e != 0 {
+			return e
+		}
+		env = append(env, fmt.Sprintf("%s=%d", lockFdEnv, fd))
+	}
+	return syscall.Exec(exe, os.Args, env)
+}
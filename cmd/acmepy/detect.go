@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PythonSuffixes are the suffixes of Python file names.
+var PythonSuffixes = []string{".py", ".pyi", ".pyw"}
+
+// PythonNames are the names of build files written in Python.
+var PythonNames = []string{"SConstruct", "SConscript", "wscript"}
+
+// A detector decides which files are Python source.
+type detector struct {
+	include []string // globs of files that are Python
+	exclude []string // globs of files that are not
+}
+
+func newDetector(include, exclude string) *detector {
+	return &detector{
+		include: splitList(include),
+		exclude: splitList(exclude),
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// isPython reports whether the named file holds Python source.
+// Excluded files never do, and included ones always do. Otherwise
+// the file must have a Python suffix, the name of a Python build
+// file, or no suffix and a first line like
+//
+//	#!/usr/bin/env python3
+func (d *detector) isPython(name string) bool {
+	if name == "" || strings.HasSuffix(name, "/") || strings.HasPrefix(filepath.Base(name), "+") {
+		return false // directory or special window
+	}
+	if matchAny(d.exclude, name) {
+		return false
+	}
+	if matchAny(d.include, name) {
+		return true
+	}
+	base := filepath.Base(name)
+	for _, s := range PythonSuffixes {
+		if strings.HasSuffix(base, s) {
+			return true
+		}
+	}
+	for _, n := range PythonNames {
+		if base == n {
+			return true
+		}
+	}
+	if filepath.Ext(base) != "" {
+		return false
+	}
+	return hasPythonShebang(name)
+}
+
+// matchAny reports whether the named file matches any of the globs.
+// Globs containing a slash are matched against the full name, others
+// against its last element.
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		s := filepath.Base(name)
+		if strings.Contains(g, "/") {
+			s = name
+		}
+		if ok, _ := filepath.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPythonShebang(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadSlice('\n')
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return false
+	}
+	for _, f := range bytes.Fields(line[2:]) {
+		if strings.HasPrefix(filepath.Base(string(f)), "python") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPython(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"script":  "#!/usr/bin/env python3\nprint(1)\n",
+		"script2": "#!/usr/bin/python2.7 -u\nprint 1\n",
+		"shell":   "#!/bin/sh\necho 1\n",
+		"notes":   "python\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"a.py", true},
+		{"a.pyi", true},
+		{"a.pyw", true},
+		{"SConstruct", true},
+		{"wscript", true},
+		{"a.go", false},
+		{"script", true},
+		{"script2", true},
+		{"shell", false},
+		{"notes", false},
+		{"gen/a_pb2.py", false},
+		{"BUILD.bazel", true},
+		{"+Errors", false},
+		{"c++_utils.py", true},
+		{"a+b.py", true},
+		{"+watch.py", false},
+		{"a.py+acmepy", false},
+	}
+	d := newDetector("BUILD.bazel,*.bzl", "*_pb2.py")
+	for _, tt := range tests {
+		if got := d.isPython(filepath.Join(dir, tt.name)); got != tt.want {
+			t.Errorf("isPython(%q) = %v; expected %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/misc/cmd/acmepy/reindent"
+)
+
+// An editorConfig holds the EditorConfig properties that apply to a
+// file, with keys and values in lower case.
+// See https://editorconfig.org/ for the file format.
+type editorConfig map[string]string
+
+// findEditorConfig reads the .editorconfig files in the directory of
+// the named file and its parents, up to the one declaring root = true,
+// and returns the properties that apply to the file.
+func findEditorConfig(name string) (editorConfig, error) {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for dir := filepath.Dir(name); ; dir = filepath.Dir(dir) {
+		file := filepath.Join(dir, ".editorconfig")
+		root, err := isRootEditorConfig(file)
+		if err == nil {
+			files = append(files, file)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	// Closer files take precedence, so apply them last.
+	ec := make(editorConfig)
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := ec.parse(files[i], name); err != nil {
+			return nil, err
+		}
+	}
+	return ec, nil
+}
+
+func isRootEditorConfig(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if k, v, ok := editorConfigPair(line); ok && k == "root" {
+			return v == "true", nil
+		}
+	}
+	return false, s.Err()
+}
+
+// parse reads the .editorconfig file and sets the properties of the
+// sections that match the named file.
+func (ec editorConfig) parse(file, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir := filepath.ToSlash(filepath.Dir(file))
+	name = filepath.ToSlash(name)
+	match := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			match = editorConfigMatch(dir, line[1:len(line)-1], name)
+		case match:
+			if k, v, ok := editorConfigPair(line); ok {
+				ec[k] = v
+			}
+		}
+	}
+	return s.Err()
+}
+
+func editorConfigPair(line string) (key, value string, ok bool) {
+	i := strings.IndexAny(line, "=:")
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	value = strings.ToLower(strings.TrimSpace(line[i+1:]))
+	return key, value, true
+}
+
+// editorConfigMatch reports whether the section glob of the
+// .editorconfig file in dir matches the file name.
+func editorConfigMatch(dir, glob, name string) bool {
+	switch {
+	case strings.HasPrefix(glob, "/"):
+		glob = glob[1:]
+	case !strings.Contains(glob, "/"):
+		glob = "**/" + glob
+	}
+	if !strings.HasPrefix(name, dir+"/") {
+		return false
+	}
+	re, ranges, err := editorConfigRegexp(glob)
+	if err != nil {
+		return false
+	}
+	m := re.FindStringSubmatch(strings.TrimPrefix(name, dir+"/"))
+	if m == nil {
+		return false
+	}
+	for i, r := range ranges {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+var numRange = regexp.MustCompile(`^\{([+-]?[0-9]+)\.\.([+-]?[0-9]+)\}`)
+
+// editorConfigRegexp translates an EditorConfig glob into a regular
+// expression. Numeric ranges {n1..n2} become capturing groups, whose
+// bounds are returned in order.
+func editorConfigRegexp(glob string) (*regexp.Regexp, [][2]int, error) {
+	var buf bytes.Buffer
+	var ranges [][2]int
+	braces := 0
+	buf.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				buf.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		case '*':
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				buf.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				buf.WriteString(".*")
+				i++
+			default:
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				buf.WriteString(`\[`)
+				break
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += j
+		case '{':
+			if m := numRange.FindStringSubmatch(glob[i:]); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				ranges = append(ranges, [2]int{lo, hi})
+				buf.WriteString("([+-]?[0-9]+)")
+				i += len(m[0]) - 1
+				break
+			}
+			braces++
+			buf.WriteString("(?:")
+		case ',':
+			if braces > 0 {
+				buf.WriteString("|")
+			} else {
+				buf.WriteString(",")
+			}
+		case '}':
+			if braces > 0 {
+				braces--
+				buf.WriteString(")")
+			} else {
+				buf.WriteString(`\}`)
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	buf.WriteString("$")
+	re, err := regexp.Compile(buf.String())
+	return re, ranges, err
+}
+
+// reindentOptions returns the indentation options given by ec, and
+// whether ec sets the indentation at all.
+func (ec editorConfig) reindentOptions() (*reindent.Options, bool) {
+	opts := new(reindent.Options)
+	style, size := ec["indent_style"], ec["indent_size"]
+	if n, err := strconv.Atoi(ec["tab_width"]); err == nil && n > 0 {
+		opts.TabWidth = n
+	}
+	if n, err := strconv.Atoi(size); err == nil && n > 0 {
+		opts.Width = n
+		if opts.TabWidth == 0 {
+			opts.TabWidth = n
+		}
+	}
+	opts.Tabs = style == "tab"
+	return opts, style == "tab" || style == "space" || opts.Width > 0
+}
+
+// normalize applies the whitespace properties of ec to src: removal of
+// trailing whitespace and the presence of a final newline.
+func (ec editorConfig) normalize(src []byte) []byte {
+	if ec["trim_trailing_whitespace"] == "true" {
+		var buf bytes.Buffer
+		for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+			text := bytes.TrimRight(line, "\r\n")
+			buf.Write(bytes.TrimRight(text, " \t"))
+			buf.Write(line[len(text):])
+		}
+		src = buf.Bytes()
+	}
+	switch ec["insert_final_newline"] {
+	case "true":
+		if len(src) > 0 && src[len(src)-1] != '\n' {
+			src = append(src, '\n')
+		}
+	case "false":
+		src = bytes.TrimRight(src, "\r\n")
+	}
+	return src
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var matchTests = []struct {
+	glob, name string
+	match      bool
+}{
+	{"*", "/p/a.py", true},
+	{"*.py", "/p/sub/a.py", true},
+	{"*.py", "/p/a.pyi", false},
+	{"*.{py,pyi}", "/p/a.pyi", true},
+	{"/*.py", "/p/sub/a.py", false},
+	{"sub/*.py", "/p/sub/a.py", true},
+	{"sub/*.py", "/p/sub/deeper/a.py", false},
+	{"sub/**.py", "/p/sub/deeper/a.py", true},
+	{"a?.py", "/p/ab.py", true},
+	{"[ab].py", "/p/b.py", true},
+	{"[!ab].py", "/p/b.py", false},
+	{"test{1..3}.py", "/p/test2.py", true},
+	{"test{1..3}.py", "/p/test4.py", false},
+	{"*.py", "/q/a.py", false},
+}
+
+func TestEditorConfigMatch(t *testing.T) {
+	for _, tt := range matchTests {
+		if m := editorConfigMatch("/p", tt.glob, tt.name); m != tt.match {
+			t.Errorf("editorConfigMatch(%q, %q) = %v; expected %v", tt.glob, tt.name, m, tt.match)
+		}
+	}
+}
+
+func TestFindEditorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".editorconfig":     "root = true\n[*]\nindent_style = space\nindent_size = 4\n[*.py]\ninsert_final_newline = true\n",
+		"sub/.editorconfig": "[*.py]\nindent_size = 2\n[*.md]\nindent_size = 8\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ec, err := findEditorConfig(filepath.Join(dir, "sub", "a.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := editorConfig{
+		"indent_style":         "space",
+		"indent_size":          "2",
+		"insert_final_newline": "true",
+	}
+	if len(ec) != len(want) {
+		t.Errorf("got %v; expected %v", ec, want)
+	}
+	for k, v := range want {
+		if ec[k] != v {
+			t.Errorf("property %s is %q; expected %q", k, ec[k], v)
+		}
+	}
+}
+
+func TestEditorConfigNormalize(t *testing.T) {
+	ec := editorConfig{"trim_trailing_whitespace": "true", "insert_final_newline": "true"}
+	got := string(ec.normalize([]byte("a = 1  \r\nb = 2\t")))
+	if want := "a = 1\r\nb = 2\n"; got != want {
+		t.Errorf("normalize returned %q; expected %q", got, want)
+	}
+}
+
+func TestFormatFinalNewline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ec := "root = true\n[*.py]\ninsert_final_newline = false\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(ec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The imports are sorted, which writes a newline after each,
+	// before the whitespace settings are applied.
+	got, err := format(context.Background(), filepath.Join(dir, "a.py"), []byte("import sys\nimport os"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "import os\nimport sys"; string(got) != want {
+		t.Errorf("format returned %q; expected %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/misc/cmd/acmepy/isort"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// firstParty returns the top-level packages and modules of the Python
+// project containing the named file. They are found in the project's
+// top directory and, for the src layout, in its src directory.
+func firstParty(name string) map[string]bool {
+	root := projectRoot(filepath.Dir(name))
+	names := make(map[string]bool)
+	for _, dir := range []string{root, filepath.Join(root, "src")} {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range infos {
+			n := fi.Name()
+			if fi.IsDir() {
+				if identifier.MatchString(n) && isPackage(filepath.Join(dir, n)) {
+					names[n] = true
+				}
+				continue
+			}
+			if mod := strings.TrimSuffix(n, ".py"); mod != n && identifier.MatchString(mod) {
+				names[mod] = true
+			}
+		}
+	}
+	return names
+}
+
+// isPackage reports whether dir holds a Python package: it has an
+// __init__.py file, or is a namespace package holding Python files.
+// Virtual environments are not packages.
+func isPackage(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "pyvenv.cfg")); err == nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(dir, "__init__.py")); err == nil {
+		return true
+	}
+	py, _ := filepath.Glob(filepath.Join(dir, "*.py"))
+	return len(py) > 0
+}
+
+// sortImports sorts the imports of src, the contents of the named
+// file, the way isort does. The max_line_length property of
+// .editorconfig sets where long imports are wrapped.
+func sortImports(name string, src []byte, ec editorConfig) ([]byte, error) {
+	c := &isort.Config{FirstParty: firstParty(name)}
+	if n, err := strconv.Atoi(ec["max_line_length"]); err == nil && n > 0 {
+		c.LineLength = n
+	}
+	return c.Source(src)
+}
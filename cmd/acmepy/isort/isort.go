@@ -0,0 +1,409 @@
+// Package isort sorts the imports at the top of Python source files.
+//
+// It follows the default style of the isort tool: imports are grouped
+// into sections, for __future__, the standard library, third party
+// packages, first party packages and relative imports, in that order,
+// separated by a blank line. Within a section, "import x" statements
+// come before "from x import y" statements, and each kind is sorted
+// case-insensitively by module. Statements importing several modules
+// are split, and "from" imports of the same module are combined, with
+// the imported names sorted constants first, then classes, then the
+// rest. Lines that become too long are wrapped in isort's grid style.
+//
+// Only the first block of imports is sorted: the import statements
+// following the module's docstring and leading comments, up to the
+// first line that is neither an import nor blank.
+package isort
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Sections, in output order.
+const (
+	future = iota
+	stdlibSection
+	thirdParty
+	firstParty
+	local
+	numSections
+)
+
+// A Config controls how imports are sorted.
+type Config struct {
+	// FirstParty holds the top-level names of the packages and
+	// modules belonging to the project. As with isort, names of the
+	// standard library stay in its section even if the project has a
+	// module of the same name, such as types.py.
+	FirstParty map[string]bool
+
+	// LineLength is the length at which "from" imports are wrapped.
+	// If zero, 79 is used.
+	LineLength int
+}
+
+// Source sorts the imports of the Python source src and returns the
+// result. If the first line of src ends in CRLF, so do the lines of
+// the sorted imports.
+func (c *Config) Source(src []byte) ([]byte, error) {
+	lines := strings.SplitAfter(string(src), "\n")
+	start, end, stmts, err := findImports(lines)
+	if err != nil || start == end {
+		return src, err
+	}
+
+	var imports []*importStmt
+	for _, s := range stmts {
+		imp, err := parseImport(s.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		for _, i := range imp {
+			i.comment = s.comment
+		}
+		imports = append(imports, imp...)
+	}
+	sorted := c.format(imports)
+	if strings.HasSuffix(lines[0], "\r\n") {
+		sorted = strings.Replace(sorted, "\n", "\r\n", -1)
+	}
+
+	var b strings.Builder
+	for _, line := range lines[:start] {
+		b.WriteString(line)
+	}
+	b.WriteString(sorted)
+	for _, line := range lines[end:] {
+		b.WriteString(line)
+	}
+	return []byte(b.String()), nil
+}
+
+// A stmt is an import statement in the source, possibly spanning
+// several lines.
+type stmt struct {
+	line    int    // first line, starting at 1
+	text    string // statement, joined into one line, without comment
+	comment string // trailing comment, including the #
+}
+
+// findImports finds the first block of imports in lines and returns
+// its extent, lines[start:end], and its statements.
+func findImports(lines []string) (start, end int, stmts []stmt, err error) {
+	i := skipPrelude(lines)
+	start, end = i, i
+	for i < len(lines) {
+		line := strings.TrimRight(lines[i], " \t\r\n")
+		switch {
+		case line == "":
+			i++
+			continue
+		case !strings.HasPrefix(line, "import ") && !strings.HasPrefix(line, "from "):
+			return start, end, stmts, nil
+		}
+
+		// Join continuation lines.
+		s := stmt{line: i + 1}
+		var text []string
+		depth := 0
+		for {
+			if i >= len(lines) {
+				return 0, 0, nil, fmt.Errorf("line %d: unterminated import", s.line)
+			}
+			line := strings.TrimRight(lines[i], " \t\r\n")
+			i++
+			if j := strings.Index(line, "#"); j >= 0 {
+				if s.comment != "" {
+					return start, end, stmts, nil // too complicated
+				}
+				s.comment = strings.TrimSpace(line[j:])
+				line = strings.TrimRight(line[:j], " \t")
+			}
+			depth += strings.Count(line, "(") - strings.Count(line, ")")
+			cont := strings.HasSuffix(line, "\\")
+			text = append(text, strings.TrimSpace(strings.TrimSuffix(line, "\\")))
+			if depth <= 0 && !cont {
+				break
+			}
+		}
+		s.text = strings.Join(text, " ")
+		if strings.Contains(s.text, ";") || s.comment != "" && len(text) > 1 {
+			return start, end, stmts, nil
+		}
+		stmts = append(stmts, s)
+		end = i
+	}
+	return start, end, stmts, nil
+}
+
+// skipPrelude returns the index of the first line after the leading
+// comments, blank lines and docstring of the module.
+func skipPrelude(lines []string) int {
+	i := 0
+	for i < len(lines) {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			i++
+		case isDocstringStart(line):
+			i = skipString(lines, i)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isDocstringStart(line string) bool {
+	line = strings.TrimLeft(line, "rRuU")
+	return strings.HasPrefix(line, `"`) || strings.HasPrefix(line, `'`)
+}
+
+// skipString returns the index of the line following the string
+// literal starting on lines[i].
+func skipString(lines []string, i int) int {
+	line := strings.TrimLeft(strings.TrimSpace(lines[i]), "rRuU")
+	quote := line[:1]
+	if strings.HasPrefix(line, quote+quote+quote) {
+		quote += quote + quote
+	}
+	rest := line[len(quote):]
+	for {
+		if strings.Contains(rest, quote) {
+			return i + 1
+		}
+		i++
+		if i >= len(lines) {
+			return i
+		}
+		rest = lines[i]
+	}
+}
+
+// An importStmt imports a single module, or names from a module.
+type importStmt struct {
+	from    bool
+	module  string
+	as      string   // for "import module as as"
+	names   []string // for "from module import names"; may contain "x as y"
+	comment string
+}
+
+// parseImport parses an import statement into one importStmt per
+// module imported.
+func parseImport(text string) ([]*importStmt, error) {
+	if strings.HasPrefix(text, "import ") {
+		var imports []*importStmt
+		for _, m := range strings.Split(strings.TrimPrefix(text, "import "), ",") {
+			f := strings.Fields(m)
+			switch {
+			case len(f) == 1:
+				imports = append(imports, &importStmt{module: f[0]})
+			case len(f) == 3 && f[1] == "as":
+				imports = append(imports, &importStmt{module: f[0], as: f[2]})
+			default:
+				return nil, fmt.Errorf("cannot parse %q", text)
+			}
+		}
+		return imports, nil
+	}
+
+	text = strings.TrimPrefix(text, "from ")
+	i := strings.Index(text, " import ")
+	if i < 0 {
+		return nil, fmt.Errorf("cannot parse %q", "from "+text)
+	}
+	imp := &importStmt{from: true, module: strings.Replace(text[:i], " ", "", -1)}
+	list := strings.TrimSpace(text[i+len(" import "):])
+	if strings.HasPrefix(list, "(") && strings.HasSuffix(list, ")") {
+		list = list[1 : len(list)-1]
+	}
+	for _, n := range strings.Split(list, ",") {
+		if n = strings.Join(strings.Fields(n), " "); n != "" {
+			imp.names = append(imp.names, n)
+		}
+	}
+	if len(imp.names) == 0 {
+		return nil, fmt.Errorf("cannot parse %q", "from "+text)
+	}
+	return []*importStmt{imp}, nil
+}
+
+func (c *Config) section(module string) int {
+	if strings.HasPrefix(module, ".") {
+		return local
+	}
+	top := module
+	if i := strings.Index(top, "."); i >= 0 {
+		top = top[:i]
+	}
+	switch {
+	case top == "__future__":
+		return future
+	case stdlib[top]:
+		return stdlibSection
+	case c.FirstParty[top]:
+		return firstParty
+	}
+	return thirdParty
+}
+
+// A line is an output line, with its sort key.
+type line struct {
+	from bool
+	key  string
+	text string
+}
+
+// format returns the sorted imports.
+func (c *Config) format(imports []*importStmt) string {
+	var sections [numSections][]line
+	add := func(imp *importStmt, l line) {
+		s := c.section(imp.module)
+		for _, x := range sections[s] {
+			if x.text == l.text {
+				return
+			}
+		}
+		sections[s] = append(sections[s], l)
+	}
+
+	// Combine "from" imports of the same module, except those with
+	// comments and those renaming what they import.
+	combined := make(map[string]*importStmt)
+	var order []*importStmt
+	for _, imp := range imports {
+		switch {
+		case !imp.from:
+			text := "import " + imp.module
+			if imp.as != "" {
+				text += " as " + imp.as
+			}
+			add(imp, line{false, moduleKey(imp.module) + " " + strings.ToLower(imp.as), withComment(text, imp.comment)})
+		case imp.comment != "":
+			text := "from " + imp.module + " import " + strings.Join(sortNames(imp.names), ", ")
+			add(imp, line{true, moduleKey(imp.module) + " 1", withComment(text, imp.comment)})
+		default:
+			for _, n := range imp.names {
+				if strings.Contains(n, " as ") {
+					add(imp, line{true, moduleKey(imp.module) + " 2" + nameKey(n), "from " + imp.module + " import " + n})
+					continue
+				}
+				m := combined[imp.module]
+				if m == nil {
+					m = &importStmt{from: true, module: imp.module}
+					combined[imp.module] = m
+					order = append(order, m)
+				}
+				m.names = append(m.names, n)
+			}
+		}
+	}
+	for _, m := range order {
+		add(m, line{true, moduleKey(m.module) + " 0", c.wrap(m.module, dedup(sortNames(m.names)))})
+	}
+
+	var out []string
+	for _, lines := range sections {
+		if len(lines) == 0 {
+			continue
+		}
+		sort.SliceStable(lines, func(i, j int) bool {
+			a, b := lines[i], lines[j]
+			if a.from != b.from {
+				return !a.from
+			}
+			return a.key < b.key
+		})
+		var b strings.Builder
+		for _, l := range lines {
+			b.WriteString(l.text + "\n")
+		}
+		out = append(out, b.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+func withComment(text, comment string) string {
+	if comment == "" {
+		return text
+	}
+	return text + "  " + comment
+}
+
+// wrap returns the statement importing names from module, wrapped in
+// isort's grid style if it is too long.
+func (c *Config) wrap(module string, names []string) string {
+	max := c.LineLength
+	if max <= 0 {
+		max = 79
+	}
+	stmt := "from " + module + " import "
+	if one := stmt + strings.Join(names, ", "); len(one) <= max || len(names) == 1 {
+		return one
+	}
+	indent := strings.Repeat(" ", len(stmt)+1)
+	text := stmt + "(" + names[0]
+	last := text
+	for _, n := range names[1:] {
+		if len(last)+len(", ")+len(n)+1 > max {
+			text += ",\n" + indent + n
+			last = indent + n
+		} else {
+			text += ", " + n
+			last += ", " + n
+		}
+	}
+	return text + ")"
+}
+
+func moduleKey(module string) string {
+	return strings.ToLower(module)
+}
+
+// nameKey returns the sort key for a name imported from a module:
+// constants come first, then classes, then everything else.
+func nameKey(name string) string {
+	prefix := "C"
+	switch {
+	case len(name) > 1 && isUpper(name):
+		prefix = "A"
+	case unicode.IsUpper([]rune(name)[0]):
+		prefix = "B"
+	}
+	return prefix + strings.ToLower(name)
+}
+
+// isUpper reports whether s has no lower-case letters and at least
+// one upper-case letter, like Python's str.isupper.
+func isUpper(s string) bool {
+	upper := false
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		upper = upper || unicode.IsUpper(r)
+	}
+	return upper
+}
+
+func sortNames(names []string) []string {
+	names = append([]string(nil), names...)
+	sort.SliceStable(names, func(i, j int) bool {
+		return nameKey(names[i]) < nameKey(names[j])
+	})
+	return names
+}
+
+func dedup(names []string) []string {
+	var out []string
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
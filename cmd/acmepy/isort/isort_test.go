@@ -0,0 +1,96 @@
+package isort
+
+import "testing"
+
+var sourceTests = []struct {
+	name, in, out string
+}{
+	{
+		"sections",
+		"import requests\nimport os\nfrom . import util\nimport myproj.db\nfrom __future__ import annotations\n",
+		"from __future__ import annotations\n\nimport os\n\nimport requests\n\nimport myproj.db\n\nfrom . import util\n",
+	},
+	{
+		"straight before from",
+		"from os import path\nimport sys\nimport os\n",
+		"import os\nimport sys\nfrom os import path\n",
+	},
+	{
+		"split and combine",
+		"import sys, os\nfrom typing import List\nfrom typing import Any, cast, TYPE_CHECKING\n",
+		"import os\nimport sys\nfrom typing import TYPE_CHECKING, Any, List, cast\n",
+	},
+	{
+		"case insensitive",
+		"import Zlib_like\nimport abc_like\n",
+		"import abc_like\nimport Zlib_like\n",
+	},
+	{
+		"as imports",
+		"import numpy as np\nfrom os import path as p, sep\n",
+		"from os import sep\nfrom os import path as p\n\nimport numpy as np\n",
+	},
+	{
+		"docstring and code kept",
+		"#!/usr/bin/env python3\n\"\"\"Doc.\n\nimport nothing\n\"\"\"\nimport sys\nimport os\n\n\ndef f():\n    import b\n    import a\n",
+		"#!/usr/bin/env python3\n\"\"\"Doc.\n\nimport nothing\n\"\"\"\nimport os\nimport sys\n\n\ndef f():\n    import b\n    import a\n",
+	},
+	{
+		"continuation",
+		"from os.path import (join,\n    dirname)\nfrom os.path import \\\n    basename\n",
+		"from os.path import basename, dirname, join\n",
+	},
+	{
+		"comments kept",
+		"import sys  # noqa\nimport os\n",
+		"import os\nimport sys  # noqa\n",
+	},
+	{
+		"stop at comment",
+		"import sys\nimport os\n# local\nimport b\nimport a\n",
+		"import os\nimport sys\n# local\nimport b\nimport a\n",
+	},
+	{
+		"wrap",
+		"from collections import OrderedDict, defaultdict, namedtuple, deque, Counter, ChainMap\n",
+		"from collections import (ChainMap, Counter, OrderedDict, defaultdict, deque,\n                         namedtuple)\n",
+	},
+	{
+		"stdlib before first party",
+		"import types\nimport myproj\nfrom secrets import token_hex\n",
+		"import types\nfrom secrets import token_hex\n\nimport myproj\n",
+	},
+	{
+		"crlf",
+		"import sys\r\nimport requests, os\r\n\r\nx = 1\r\n",
+		"import os\r\nimport sys\r\n\r\nimport requests\r\n\r\nx = 1\r\n",
+	},
+	{
+		"crlf wrapped",
+		"from collections import OrderedDict, defaultdict, namedtuple, deque, Counter, ChainMap\r\n",
+		"from collections import (ChainMap, Counter, OrderedDict, defaultdict, deque,\r\n                         namedtuple)\r\n",
+	},
+	{
+		"no imports",
+		"x = 1\nimport os\n",
+		"x = 1\nimport os\n",
+	},
+}
+
+func TestSource(t *testing.T) {
+	c := &Config{FirstParty: map[string]bool{"myproj": true, "types": true, "secrets": true}}
+	for _, tt := range sourceTests {
+		out, err := c.Source([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("%s: got\n%s\nexpected\n%s", tt.name, out, tt.out)
+		}
+		again, err := c.Source(out)
+		if err != nil || string(again) != string(out) {
+			t.Errorf("%s: not idempotent: got\n%s", tt.name, again)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package isort
+
+// stdlib is the set of modules in the Python standard library:
+// sys.stdlib_module_names of Python 3.11, the modules removed in
+// Python 3.8 to 3.11, and the Python 2 modules renamed in Python 3.
+var stdlib = map[string]bool{
+	"__builtin__":                true,
+	"__future__":                 true,
+	"_abc":                       true,
+	"_aix_support":               true,
+	"_ast":                       true,
+	"_asyncio":                   true,
+	"_bisect":                    true,
+	"_blake2":                    true,
+	"_bootsubprocess":            true,
+	"_bz2":                       true,
+	"_codecs":                    true,
+	"_codecs_cn":                 true,
+	"_codecs_hk":                 true,
+	"_codecs_iso2022":            true,
+	"_codecs_jp":                 true,
+	"_codecs_kr":                 true,
+	"_codecs_tw":                 true,
+	"_collections":               true,
+	"_collections_abc":           true,
+	"_compat_pickle":             true,
+	"_compression":               true,
+	"_contextvars":               true,
+	"_crypt":                     true,
+	"_csv":                       true,
+	"_ctypes":                    true,
+	"_curses":                    true,
+	"_curses_panel":              true,
+	"_datetime":                  true,
+	"_dbm":                       true,
+	"_decimal":                   true,
+	"_dummy_thread":              true,
+	"_elementtree":               true,
+	"_frozen_importlib":          true,
+	"_frozen_importlib_external": true,
+	"_functools":                 true,
+	"_gdbm":                      true,
+	"_hashlib":                   true,
+	"_heapq":                     true,
+	"_imp":                       true,
+	"_io":                        true,
+	"_json":                      true,
+	"_locale":                    true,
+	"_lsprof":                    true,
+	"_lzma":                      true,
+	"_markupbase":                true,
+	"_md5":                       true,
+	"_msi":                       true,
+	"_multibytecodec":            true,
+	"_multiprocessing":           true,
+	"_opcode":                    true,
+	"_operator":                  true,
+	"_osx_support":               true,
+	"_overlapped":                true,
+	"_pickle":                    true,
+	"_posixshmem":                true,
+	"_posixsubprocess":           true,
+	"_py_abc":                    true,
+	"_pydecimal":                 true,
+	"_pyio":                      true,
+	"_queue":                     true,
+	"_random":                    true,
+	"_scproxy":                   true,
+	"_sha1":                      true,
+	"_sha256":                    true,
+	"_sha3":                      true,
+	"_sha512":                    true,
+	"_signal":                    true,
+	"_sitebuiltins":              true,
+	"_socket":                    true,
+	"_sqlite3":                   true,
+	"_sre":                       true,
+	"_ssl":                       true,
+	"_stat":                      true,
+	"_statistics":                true,
+	"_string":                    true,
+	"_strptime":                  true,
+	"_struct":                    true,
+	"_symtable":                  true,
+	"_thread":                    true,
+	"_threading_local":           true,
+	"_tkinter":                   true,
+	"_tokenize":                  true,
+	"_tracemalloc":               true,
+	"_typing":                    true,
+	"_uuid":                      true,
+	"_warnings":                  true,
+	"_weakref":                   true,
+	"_weakrefset":                true,
+	"_winapi":                    true,
+	"_zoneinfo":                  true,
+	"abc":                        true,
+	"aifc":                       true,
+	"antigravity":                true,
+	"anydbm":                     true,
+	"argparse":                   true,
+	"array":                      true,
+	"ast":                        true,
+	"asynchat":                   true,
+	"asyncio":                    true,
+	"asyncore":                   true,
+	"atexit":                     true,
+	"audioop":                    true,
+	"base64":                     true,
+	"BaseHTTPServer":             true,
+	"bdb":                        true,
+	"binascii":                   true,
+	"binhex":                     true,
+	"bisect":                     true,
+	"builtins":                   true,
+	"bz2":                        true,
+	"calendar":                   true,
+	"cgi":                        true,
+	"CGIHTTPServer":              true,
+	"cgitb":                      true,
+	"chunk":                      true,
+	"cmath":                      true,
+	"cmd":                        true,
+	"code":                       true,
+	"codecs":                     true,
+	"codeop":                     true,
+	"collections":                true,
+	"colorsys":                   true,
+	"commands":                   true,
+	"compileall":                 true,
+	"concurrent":                 true,
+	"ConfigParser":               true,
+	"configparser":               true,
+	"contextlib":                 true,
+	"contextvars":                true,
+	"Cookie":                     true,
+	"cookielib":                  true,
+	"copy":                       true,
+	"copy_reg":                   true,
+	"copyreg":                    true,
+	"cPickle":                    true,
+	"cProfile":                   true,
+	"crypt":                      true,
+	"cStringIO":                  true,
+	"csv":                        true,
+	"ctypes":                     true,
+	"curses":                     true,
+	"dataclasses":                true,
+	"datetime":                   true,
+	"dbhash":                     true,
+	"dbm":                        true,
+	"decimal":                    true,
+	"difflib":                    true,
+	"dis":                        true,
+	"distutils":                  true,
+	"doctest":                    true,
+	"dumbdbm":                    true,
+	"dummy_thread":               true,
+	"dummy_threading":            true,
+	"email":                      true,
+	"encodings":                  true,
+	"ensurepip":                  true,
+	"enum":                       true,
+	"errno":                      true,
+	"exceptions":                 true,
+	"faulthandler":               true,
+	"fcntl":                      true,
+	"filecmp":                    true,
+	"fileinput":                  true,
+	"fnmatch":                    true,
+	"formatter":                  true,
+	"fractions":                  true,
+	"ftplib":                     true,
+	"functools":                  true,
+	"gc":                         true,
+	"gdbm":                       true,
+	"genericpath":                true,
+	"getopt":                     true,
+	"getpass":                    true,
+	"gettext":                    true,
+	"glob":                       true,
+	"graphlib":                   true,
+	"grp":                        true,
+	"gzip":                       true,
+	"hashlib":                    true,
+	"heapq":                      true,
+	"hmac":                       true,
+	"html":                       true,
+	"htmlentitydefs":             true,
+	"HTMLParser":                 true,
+	"http":                       true,
+	"httplib":                    true,
+	"idlelib":                    true,
+	"imaplib":                    true,
+	"imghdr":                     true,
+	"imp":                        true,
+	"importlib":                  true,
+	"inspect":                    true,
+	"io":                         true,
+	"ipaddress":                  true,
+	"itertools":                  true,
+	"json":                       true,
+	"keyword":                    true,
+	"lib2to3":                    true,
+	"linecache":                  true,
+	"locale":                     true,
+	"logging":                    true,
+	"lzma":                       true,
+	"macpath":                    true,
+	"mailbox":                    true,
+	"mailcap":                    true,
+	"marshal":                    true,
+	"math":                       true,
+	"md5":                        true,
+	"mimetypes":                  true,
+	"mmap":                       true,
+	"modulefinder":               true,
+	"msilib":                     true,
+	"msvcrt":                     true,
+	"multiprocessing":            true,
+	"netrc":                      true,
+	"new":                        true,
+	"nis":                        true,
+	"nntplib":                    true,
+	"nt":                         true,
+	"ntpath":                     true,
+	"nturl2path":                 true,
+	"numbers":                    true,
+	"opcode":                     true,
+	"operator":                   true,
+	"optparse":                   true,
+	"os":                         true,
+	"ossaudiodev":                true,
+	"parser":                     true,
+	"pathlib":                    true,
+	"pdb":                        true,
+	"pickle":                     true,
+	"pickletools":                true,
+	"pipes":                      true,
+	"pkgutil":                    true,
+	"platform":                   true,
+	"plistlib":                   true,
+	"poplib":                     true,
+	"posix":                      true,
+	"posixpath":                  true,
+	"pprint":                     true,
+	"profile":                    true,
+	"pstats":                     true,
+	"pty":                        true,
+	"pwd":                        true,
+	"py_compile":                 true,
+	"pyclbr":                     true,
+	"pydoc":                      true,
+	"pydoc_data":                 true,
+	"pyexpat":                    true,
+	"Queue":                      true,
+	"queue":                      true,
+	"quopri":                     true,
+	"random":                     true,
+	"re":                         true,
+	"readline":                   true,
+	"repr":                       true,
+	"reprlib":                    true,
+	"resource":                   true,
+	"rlcompleter":                true,
+	"robotparser":                true,
+	"runpy":                      true,
+	"sched":                      true,
+	"secrets":                    true,
+	"select":                     true,
+	"selectors":                  true,
+	"sets":                       true,
+	"sha":                        true,
+	"shelve":                     true,
+	"shlex":                      true,
+	"shutil":                     true,
+	"signal":                     true,
+	"SimpleHTTPServer":           true,
+	"site":                       true,
+	"smtpd":                      true,
+	"smtplib":                    true,
+	"sndhdr":                     true,
+	"socket":                     true,
+	"SocketServer":               true,
+	"socketserver":               true,
+	"spwd":                       true,
+	"sqlite3":                    true,
+	"sre_compile":                true,
+	"sre_constants":              true,
+	"sre_parse":                  true,
+	"ssl":                        true,
+	"stat":                       true,
+	"statistics":                 true,
+	"string":                     true,
+	"StringIO":                   true,
+	"stringprep":                 true,
+	"struct":                     true,
+	"subprocess":                 true,
+	"sunau":                      true,
+	"symbol":                     true,
+	"symtable":                   true,
+	"sys":                        true,
+	"sysconfig":                  true,
+	"syslog":                     true,
+	"tabnanny":                   true,
+	"tarfile":                    true,
+	"telnetlib":                  true,
+	"tempfile":                   true,
+	"termios":                    true,
+	"textwrap":                   true,
+	"this":                       true,
+	"thread":                     true,
+	"threading":                  true,
+	"time":                       true,
+	"timeit":                     true,
+	"Tkinter":                    true,
+	"tkinter":                    true,
+	"token":                      true,
+	"tokenize":                   true,
+	"tomllib":                    true,
+	"trace":                      true,
+	"traceback":                  true,
+	"tracemalloc":                true,
+	"tty":                        true,
+	"turtle":                     true,
+	"turtledemo":                 true,
+	"types":                      true,
+	"typing":                     true,
+	"unicodedata":                true,
+	"unittest":                   true,
+	"urllib":                     true,
+	"urllib2":                    true,
+	"urlparse":                   true,
+	"UserDict":                   true,
+	"UserList":                   true,
+	"UserString":                 true,
+	"uu":                         true,
+	"uuid":                       true,
+	"venv":                       true,
+	"warnings":                   true,
+	"wave":                       true,
+	"weakref":                    true,
+	"webbrowser":                 true,
+	"whichdb":                    true,
+	"winreg":                     true,
+	"winsound":                   true,
+	"wsgiref":                    true,
+	"xdrlib":                     true,
+	"xml":                        true,
+	"xmlrpc":                     true,
+	"xmlrpclib":                  true,
+	"zipapp":                     true,
+	"zipfile":                    true,
+	"zipimport":                  true,
+	"zlib":                       true,
+	"zoneinfo":                   true,
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// Linters maps the names accepted by the -lint flag to the command
+// lines that run them. The file name is appended to the command line.
+var Linters = map[string][]string{
+	"pyflakes": {"pyflakes"},
+	"flake8":   {"flake8"},
+	"ruff":     {"ruff", "check", "--no-fix", "--output-format=concise"},
+	"mypy":     {"mypy", "--show-column-numbers", "--no-error-summary", "--no-color-output"},
+}
+
+// FindingRef matches a line of linter output of the form
+// file:line[:col]: message.
+var FindingRef = regexp.MustCompile(`^(.+?):([0-9]+):(?:([0-9]+):)?\s*(.*)$`)
+
+// A finding is a single problem reported by a linter.
+type finding struct {
+	file      string
+	line, col int
+	msg       string
+	tools     []string
+}
+
+func (f *finding) String() string {
+	return fmt.Sprintf("%s:%d: %s [%s]", f.file, f.line, f.msg, strings.Join(f.tools, ","))
+}
+
+// lintCommand returns the command line for the linter named by spec.
+// A spec that is not a known linter name is used as a command line.
+func lintCommand(spec string) []string {
+	if args, ok := Linters[spec]; ok {
+		return args
+	}
+	return strings.Fields(spec)
+}
+
+// lint runs the linters on the named file concurrently, and writes
+// their deduplicated findings to the acme +Errors window.
+func lint(ctx context.Context, name string, tools []string) {
+	results := make([][]*finding, len(tools))
+	var wg sync.WaitGroup
+	for i, tool := range tools {
+		wg.Add(1)
+		go func(i int, tool string) {
+			defer wg.Done()
+			results[i] = runLinter(ctx, name, tool)
+		}(i, tool)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	findings := dedupFindings(results)
+	if len(findings) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	for _, f := range findings {
+		fmt.Fprintf(&buf, "%v\n", f)
+	}
+	acme.Err(name, buf.String())
+}
+
+func runLinter(ctx context.Context, name, tool string) []*finding {
+	args := lintCommand(tool)
+	if len(args) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(name)
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], name)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		log.Printf("%s: %v", args[0], err)
+		return nil
+	}
+	return parseFindings(out, dir, filepath.Base(args[0]))
+}
+
+// parseFindings parses linter output. Relative file names are
+// interpreted relative to dir.
+func parseFindings(out []byte, dir, tool string) []*finding {
+	var findings []*finding
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		m := FindingRef.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		file := m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		findings = append(findings, &finding{
+			file:  file,
+			line:  line,
+			col:   col,
+			msg:   m[4],
+			tools: []string{tool},
+		})
+	}
+	return findings
+}
+
+var (
+	findingCode    = regexp.MustCompile(`^(?:[A-Z]+[0-9]+ |error: |warning: |note: )(?:\[\*\] )?`)
+	findingErrCode = regexp.MustCompile(` +\[[a-z-]+\]$`)
+	findingQuote   = strings.NewReplacer("'", "", "\"", "", "`", "")
+)
+
+// findingKey returns a key identifying the problem reported by f,
+// ignoring differences in how each tool words it.
+func findingKey(f *finding) string {
+	msg := findingCode.ReplaceAllString(f.msg, "")
+	msg = findingErrCode.ReplaceAllString(msg, "")
+	msg = strings.ToLower(findingQuote.Replace(msg))
+	return fmt.Sprintf("%s:%d:%s", f.file, f.line, msg)
+}
+
+// dedupFindings merges the findings of all linters, dropping problems
+// already reported by another tool, and sorts them by position.
+func dedupFindings(results [][]*finding) []*finding {
+	seen := make(map[string]*finding)
+	var all []*finding
+	for _, findings := range results {
+		for _, f := range findings {
+			k := findingKey(f)
+			if g, ok := seen[k]; ok {
+				if g.tools[len(g.tools)-1] != f.tools[0] {
+					g.tools = append(g.tools, f.tools...)
+				}
+				continue
+			}
+			seen[k] = f
+			all = append(all, f)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.col < b.col
+	})
+	return all
+}
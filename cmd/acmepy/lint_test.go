@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestDedupFindings(t *testing.T) {
+	outputs := []struct {
+		tool, out string
+	}{
+		{"pyflakes", "a.py:1:1: 'os' imported but unused\n" +
+			"a.py:3:5: undefined name 'x'\n"},
+		{"flake8", "a.py:1:1: F401 'os' imported but unused\n" +
+			"a.py:3:5: F821 undefined name 'x'\n" +
+			"a.py:7:80: E501 line too long (88 > 79 characters)\n"},
+		{"ruff", "a.py:1:8: F401 [*] `os` imported but unused\n" +
+			"a.py:3:5: F821 Undefined name `x`\n" +
+			"Found 2 errors.\n" +
+			"[*] 1 fixable with the `--fix` option.\n"},
+		{"mypy", "a.py:3:5: error: Name \"x\" is not defined  [name-defined]\n"},
+	}
+	var results [][]*finding
+	for _, o := range outputs {
+		results = append(results, parseFindings([]byte(o.out), "/src", o.tool))
+	}
+	want := []string{
+		"/src/a.py:1: 'os' imported but unused [pyflakes,flake8,ruff]",
+		"/src/a.py:3: undefined name 'x' [pyflakes,flake8,ruff]",
+		"/src/a.py:3: error: Name \"x\" is not defined  [name-defined] [mypy]",
+		"/src/a.py:7: E501 line too long (88 > 79 characters) [flake8]",
+	}
+	got := dedupFindings(results)
+	if len(got) != len(want) {
+		t.Fatalf("got %d findings %v; expected %d", len(got), got, len(want))
+	}
+	for i, f := range got {
+		if f.String() != want[i] {
+			t.Errorf("finding %d is %q; expected %q", i, f, want[i])
+		}
+	}
+}
+
+func TestFindingKey(t *testing.T) {
+	tests := []struct {
+		msg, key string
+	}{
+		{"'os' imported but unused", "a.py:1:os imported but unused"},
+		{"F401 'os' imported but unused", "a.py:1:os imported but unused"},
+		{"F401 [*] `os` imported but unused", "a.py:1:os imported but unused"},
+		{"error: Module \"os\" has no attribute \"x\"  [attr-defined]", "a.py:1:module os has no attribute x"},
+	}
+	for _, tt := range tests {
+		if got := findingKey(&finding{file: "a.py", line: 1, msg: tt.msg}); got != tt.key {
+			t.Errorf("findingKey(%q) = %q; expected %q", tt.msg, got, tt.key)
+		}
+	}
+}
@@ -4,91 +4,356 @@
 
 // Adapted from https://godoc.org/9fans.net/go/acme/acmego
 
-// Acmepy watches acme for .py files being written.
-// Each time a .py file is written, acmepy checks whether the
+// Acmepy watches acme for Python files being written.
+// Each time a Python file is written, acmepy checks whether the
 // (4-space) indentations need to be fixed. If so, it makes the
 // changes in the window body but does not write the file.
+//
+// Usage:
+//
+//	acmepy [-fmt command] [-include globs] [-exclude globs] [-isort=false]
+//		[-lint linter,...] [-pidfile file] [-preview] [-timeout duration]
+//		[-test runner [-testpat patterns]]
+//	acmepy -tb
+//
+// Python files are those with the suffix .py, .pyi or .pyw, the
+// SConstruct, SConscript and wscript build files, and files without
+// a suffix whose first line is a shebang line running python, such as
+//
+//	#!/usr/bin/env python3
+//
+// The -include and -exclude flags give comma-separated globs of other
+// files to treat as Python and of files to leave alone. Globs without
+// a slash are matched against the last element of the file name, and
+// others against the full name.
+//
+// By default the indentation is fixed by a built-in reimplementation
+// of Python's reindent.py script, so no Python installation is needed.
+// The -fmt flag names an external formatter to use instead, which
+// reads the file on standard input and writes the formatted file to
+// standard output, for example
+//
+//	acmepy -fmt /usr/lib/python2.7/Tools/scripts/reindent.py
+//
+// Acmepy honors the indent_style, indent_size, tab_width,
+// trim_trailing_whitespace and insert_final_newline properties found
+// in the .editorconfig files that apply to the file (see
+// https://editorconfig.org). The indentation properties are applied
+// before the -fmt formatter runs, and the whitespace properties last,
+// after the imports are sorted. The built-in reindent always removes
+// trailing whitespace, regardless of trim_trailing_whitespace.
+//
+// With the -tb flag, acmepy is instead a filter that copies standard
+// input to standard output, rewriting the frames of Python tracebacks,
+// such as
+//
+//	File "/home/gopher/src/x.py", line 12, in main
+//
+// into plumbable addresses relative to the current directory:
+//
+//	src/x.py:12 in main
+//
+// For example, run a script in win(1) as
+//
+//	python3 x.py 2>&1 | acmepy -tb
+//
+// In preview mode, acmepy leaves the window alone and instead shows the
+// unified diff of the changes it would make in a window named after
+// the file, such as /src/a.py+acmepy. Executing Apply in that window
+// makes the changes. The -preview flag turns on preview mode for all
+// windows; executing "Acmepy preview" in a window's tag then toggles
+// it for that window. Only with -preview does acmepy read the events
+// of the Python windows, which other programs, such as win, cannot
+// then do.
+//
+// The -test flag makes acmepy run the tests of each file it sees
+// written, using the pytest or unittest runner. The tests run in the
+// background, alongside formatting. Test files are found using the
+// comma-separated patterns of the -testpat flag, which are file names
+// relative to the written file's directory, with %s standing for its
+// module name; the default finds test_foo.py and tests/test_foo.py
+// for foo.py. A written test file is run itself. The tests run in the
+// project's top directory, the closest one containing pyproject.toml,
+// setup.py, setup.cfg, tox.ini, pytest.ini or .git. Failures are
+// summarized in the +Errors window, with plumbable addresses.
+//
+// Acmepy is meant to run as a daemon for the lifetime of the session.
+// Only one instance runs per plan9port name space: it holds a lock on
+// the file named by the -pidfile flag, which contains its process ID.
+// If acme is not running, acmepy waits for it to start. If acme exits,
+// acmepy logs the error, waits for acme to be restarted and starts
+// over, picking up the Python windows already open.
+//
+// Each window is handled by its own worker, so a slow formatter does
+// not hold up other windows. A put made while the window's file is
+// still being formatted cancels that work; only the latest put is
+// handled. Formatting and linting that take longer than the -timeout
+// flag (default 30s) are abandoned.
+//
+// Acmepy also sorts the imports at the top of the file the way the
+// isort tool does by default: __future__ imports, the standard
+// library, third party packages, first party packages and relative
+// imports, each group sorted and separated by a blank line. First
+// party packages are those found in the project's top directory or
+// its src directory. The .editorconfig max_line_length property sets
+// where long imports are wrapped. The -isort=false flag turns sorting
+// off.
+//
+// The -lint flag names linters to run on the file after it is
+// formatted. The known linters are pyflakes, flake8, ruff and mypy;
+// any other name is run as a command line, with the file name
+// appended, that reports problems as file:line[:col]: message.
+// The linters run concurrently. Their findings are merged, with
+// duplicates reported by more than one linter removed, and written
+// to the acme +Errors window as plumbable file:line addresses. The
+// linters read the file as written, so when formatting changes the
+// window, they run on the next put instead, so that their addresses
+// match the window.
 package main
 
 import (
 	"bytes"
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"9fans.net/go/acme"
+	"github.com/fhs/misc/cmd/acmepy/reindent"
 )
 
-var LineRef = regexp.MustCompile(`File "([a-zA-Z¡-￿0-9_\-./]+)", line ([0-9]+)`)
+// LineRef matches a frame of a Python traceback.
+var LineRef = regexp.MustCompile(`File "(.+?)", line ([0-9]+)(?:, in (.+))?`)
+
+var (
+	fmtFlag     = flag.String("fmt", "", "external formatter `command` (default built-in reindent)")
+	includeFlag = flag.String("include", "", "comma-separated `globs` of other files to treat as Python")
+	isortFlag   = flag.Bool("isort", true, "sort imports like isort")
+	excludeFlag = flag.String("exclude", "", "comma-separated `globs` of files to ignore")
+	pidFlag     = flag.String("pidfile", "", "lock `file` ensuring a single instance (default $NAMESPACE/acmepy.pid)")
+	lintFlag    = flag.String("lint", "", "comma-separated list of linters to run after formatting")
+	previewFlag = flag.Bool("preview", false, "show changes in a +acmepy window instead of making them")
+	tbFlag      = flag.Bool("tb", false, "filter Python tracebacks from standard input")
+	testFlag    = flag.String("test", "", "run tests after put, with `runner` pytest or unittest")
+	testPatFlag = flag.String("testpat", "test_%s.py,tests/test_%s.py", "comma-separated test file `patterns`")
+	timeout     = flag.Duration("timeout", 30*time.Second, "time limit for formatting, linting and testing a file")
+)
+
+// lintTools are the linters named by the -lint flag.
+var lintTools []string
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: acmepy [-fmt command] [-include globs] [-exclude globs] [-isort=false]\n")
+	fmt.Fprintf(os.Stderr, "\t[-lint linter,...] [-pidfile file] [-preview] [-timeout duration]\n")
+	fmt.Fprintf(os.Stderr, "\t[-test runner [-testpat patterns]]\n")
+	fmt.Fprintf(os.Stderr, "       acmepy -tb\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
 
 func main() {
-	l, err := acme.Log()
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
+	if *tbFlag {
+		dir, err := os.Getwd()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := filterTraceback(os.Stdout, os.Stdin, dir); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *lintFlag != "" {
+		lintTools = strings.Split(*lintFlag, ",")
+	}
+	detect := newDetector(*includeFlag, *excludeFlag)
+	var tests *tester
+	switch *testFlag {
+	case "":
+	case "pytest", "unittest":
+		tests = newTester(*testFlag, strings.Split(*testPatFlag, ","))
+	default:
+		log.Fatalf("unknown test runner %q", *testFlag)
+	}
+
+	unlock, err := lockPidFile(pidFile())
 	if err != nil {
 		log.Fatal(err)
 	}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		unlock()
+		os.Exit(0)
+	}()
+
+	waitForAcme()
+	err = watch(detect, tests)
+	log.Printf("lost connection to acme: %v", err)
+
+	// The acme package cannot reconnect, so start over in a new
+	// process once acme is back.
+	waitForAcme()
+	log.Print("restarting")
+	log.Fatal(restart())
+}
+
+// watch handles the acme log events until reading the log fails.
+// It first sets up workers for the Python windows already open.
+func watch(detect *detector, tests *tester) error {
+	l, err := acme.Log()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	workers := make(map[int]*worker)
+	wins, err := acme.Windows()
+	if err != nil {
+		return err
+	}
+	for _, info := range wins {
+		if detect.isPython(info.Name) {
+			workers[info.ID] = newWorker(info.ID, info.Name)
+		}
+	}
 
 	for {
 		event, err := l.Read()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		if event.Name != "" && event.Op == "put" && strings.HasSuffix(event.Name, ".py") {
-			reformat(event.ID, event.Name)
+		switch event.Op {
+		case "new", "get", "put":
+			if detect.isPython(event.Name) {
+				w := workers[event.ID]
+				if w == nil {
+					w = newWorker(event.ID, event.Name)
+					workers[event.ID] = w
+				}
+				if event.Op == "put" {
+					w.put(event.Name)
+					if tests != nil {
+						tests.put(event.Name)
+					}
+				}
+			}
+		case "del":
+			if w := workers[event.ID]; w != nil {
+				w.stop()
+				delete(workers, event.ID)
+			}
 		}
 	}
 }
 
-func reformat(id int, name string) {
+// process formats the file of window id and lints it. In preview
+// mode, the changes are shown in a +acmepy window instead of being
+// made in the window. The linters read the file, so if formatting
+// changed the window, linting is left to the put saving the changes.
+func process(ctx context.Context, id int, name string, preview bool) {
+	changed := reformat(ctx, id, name, preview)
+	if len(lintTools) > 0 && !changed && ctx.Err() == nil {
+		lint(ctx, name, lintTools)
+	}
+}
+
+// reformat formats the file of window id, and reports whether it
+// changed the window body.
+func reformat(ctx context.Context, id int, name string, preview bool) bool {
 	w, err := acme.Open(id, nil)
 	if err != nil {
 		log.Print(err)
-		return
+		return false
 	}
 	defer w.CloseFiles()
 
 	old, err := ioutil.ReadFile(name)
 	if err != nil {
 		//log.Print(err)
-		return
+		return false
+	}
+	new, err := format(ctx, name, old)
+	if ctx.Err() != nil {
+		return false
 	}
-	cmd := exec.Command("/usr/lib/python2.7/Tools/scripts/reindent.py")
-	cmd.Stdin = bytes.NewReader(old)
-	new, err := cmd.CombinedOutput()
 	if err != nil {
 		// Probably a syntax error, use the compiler for better message.
-		cmd := exec.Command("python", "-m", "py_compile", name)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s", LineRef.ReplaceAll(out, []byte("File $1:$2")))
-			return
+		cmd := exec.CommandContext(ctx, "python", "-m", "py_compile", name)
+		out, cerr := cmd.CombinedOutput()
+		if _, ok := cerr.(*exec.ExitError); ok {
+			filterTraceback(os.Stderr, bytes.NewReader(out), "")
+			return false
 		}
-		return
+		if rerr, ok := err.(*reindent.Error); ok {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", name, rerr.Line, rerr.Msg)
+			return false
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return false
 	}
 
 	if bytes.Equal(old, new) {
-		return
+		return false
 	}
 
-	f, err := ioutil.TempFile("", "acmepy")
+	if preview {
+		showPreview(ctx, id, name, old, new)
+		return false
+	}
+	diff, err := diffFile(ctx, name, new)
+	if ctx.Err() != nil {
+		// Superseded by a newer put, or timed out.
+		return false
+	}
 	if err != nil {
 		log.Print(err)
-		return
+		return false
 	}
-	if _, err := f.Write(new); err != nil {
-		log.Print(err)
-		return
+	applyDiff(w, new, diff)
+	return true
+}
+
+// diffFile compares the named file with new using 9 diff, run with
+// the given flags, and returns the output.
+func diffFile(ctx context.Context, name string, new []byte, flags ...string) ([]byte, error) {
+	f, err := ioutil.TempFile("", "acmepy")
+	if err != nil {
+		return nil, err
 	}
 	tmp := f.Name()
-	f.Close()
 	defer os.Remove(tmp)
+	_, err = f.Write(new)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
 
-	diff, _ := exec.Command("9", "diff", name, tmp).CombinedOutput()
+	args := append(append([]string{"diff"}, flags...), name, tmp)
+	diff, err := exec.CommandContext(ctx, "9", args...).CombinedOutput()
+	if _, ok := err.(*exec.ExitError); ok {
+		err = nil // files differ
+	}
+	return bytes.Replace(diff, []byte(tmp), []byte(name), -1), err
+}
 
+// applyDiff edits the body of window w, using the output of 9 diff
+// between the window's file and new, so that the body matches new.
+func applyDiff(w *acme.Win, new, diff []byte) {
 	w.Write("ctl", []byte("mark"))
 	w.Write("ctl", []byte("nomark"))
 	diffLines := strings.Split(string(diff), "\n")
@@ -139,6 +404,44 @@ func reformat(id int, name string) {
 	}
 }
 
+// format formats src, the contents of the named file. It first
+// applies the .editorconfig indentation settings for the file, then
+// runs the formatter named by the -fmt flag, if any. Without a
+// formatter, the indentation is always fixed, with 4 spaces unless
+// .editorconfig says otherwise. Then the imports are sorted, unless
+// -isort=false, and last the .editorconfig whitespace settings are
+// applied.
+func format(ctx context.Context, name string, src []byte) ([]byte, error) {
+	ec, err := findEditorConfig(name)
+	if err != nil {
+		log.Print(err)
+	}
+	args := strings.Fields(*fmtFlag)
+	if opts, ok := ec.reindentOptions(); ok || len(args) == 0 {
+		src, err = opts.Source(src)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 0 {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(src)
+		cmd.Stderr = &stderr
+		src, err = cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v\n%s", args[0], err, stderr.Bytes())
+		}
+	}
+	if *isortFlag {
+		src, err = sortImports(name, src, ec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ec.normalize(src), nil
+}
+
 func parseSpan(text string) (start, end int) {
 	i := strings.Index(text, ",")
 	if i < 0 {
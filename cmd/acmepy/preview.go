@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// A preview is a +acmepy window showing the changes the formatter
+// would make to a file. Executing Apply in the window makes them.
+type preview struct {
+	win *acme.Win
+
+	mu       sync.Mutex
+	id       int    // window of the file
+	name     string // file name
+	old, new []byte // file contents before and after formatting
+}
+
+var (
+	previewsMu sync.Mutex
+	previews   = make(map[string]*preview) // by window name
+)
+
+// showPreview writes the unified diff between old and new, the
+// contents of the file name in window id, to the file's +acmepy
+// window, named name+"+acmepy", replacing what was there. Each file
+// has its own window, so that previews of several files can be
+// applied independently.
+func showPreview(ctx context.Context, id int, name string, old, new []byte) {
+	diff, err := diffFile(ctx, name, new, "-u")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	p, err := openPreview(name + "+acmepy")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	p.mu.Lock()
+	p.id, p.name, p.old, p.new = id, name, old, new
+	p.mu.Unlock()
+
+	p.win.Clear()
+	p.win.Write("body", diff)
+	p.win.Fprintf("body", "\nExecute Apply to make these changes in %s.\n", name)
+	p.win.Ctl("clean")
+	p.win.Addr("0")
+	p.win.Ctl("dot=addr")
+	p.win.Ctl("show")
+}
+
+// openPreview returns the +acmepy window with the given name,
+// creating it if necessary.
+func openPreview(wname string) (*preview, error) {
+	previewsMu.Lock()
+	defer previewsMu.Unlock()
+
+	if p := previews[wname]; p != nil {
+		return p, nil
+	}
+	win, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	win.Name("%s", wname)
+	win.Fprintf("tag", "Apply ")
+	p := &preview{win: win}
+	previews[wname] = p
+	go func() {
+		win.EventLoop(p)
+		previewsMu.Lock()
+		delete(previews, wname)
+		previewsMu.Unlock()
+		win.CloseFiles()
+	}()
+	return p, nil
+}
+
+// ExecApply makes the previewed changes in the file's window, provided
+// the file has not changed since the preview was made.
+func (p *preview) ExecApply() {
+	p.mu.Lock()
+	id, name, old, new := p.id, p.name, p.old, p.new
+	p.mu.Unlock()
+	if name == "" {
+		return
+	}
+
+	cur, err := ioutil.ReadFile(name)
+	if err != nil {
+		p.win.Err(err.Error())
+		return
+	}
+	if !bytes.Equal(cur, old) {
+		p.win.Errf("%s has changed since the preview; Put it again", name)
+		return
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		p.win.Err(err.Error())
+		return
+	}
+	defer w.CloseFiles()
+	body, err := w.ReadAll("body")
+	if err != nil {
+		p.win.Err(err.Error())
+		return
+	}
+	if !bytes.Equal(body, old) {
+		p.win.Errf("window of %s has been edited since the preview; Put it again", name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	diff, err := diffFile(ctx, name, new)
+	if err != nil {
+		p.win.Err(err.Error())
+		return
+	}
+	applyDiff(w, new, diff)
+
+	p.mu.Lock()
+	p.name, p.old, p.new = "", nil, nil
+	p.mu.Unlock()
+	p.win.Clear()
+	p.win.Fprintf("body", "Applied changes to %s.\n", name)
+	p.win.Ctl("clean")
+}
+
+func (p *preview) Execute(cmd string) bool { return false }
+func (p *preview) Look(arg string) bool    { return false }
@@ -0,0 +1,239 @@
+// Package reindent normalizes the indentation of Python source code.
+//
+// It is a Go implementation of the reindent.py script distributed
+// with Python: indentation is changed to 4 spaces per level (or as
+// configured by Options), tabs are expanded, trailing whitespace is
+// removed from every line, empty lines at the end of the file are
+// removed, and the last line ends with a newline. Files whose first
+// line ends in CRLF keep CRLF line endings. Comment lines and
+// continuation lines are shifted along with the statements they
+// belong to.
+package reindent
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Error describes a problem tokenizing the source.
+type Error struct {
+	Line int    // line number, starting at 1
+	Msg  string // description of the problem
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Options controls the indentation produced by Options.Source.
+type Options struct {
+	Width    int  // columns per indentation level; 4 if zero
+	TabWidth int  // columns per tab written; 8 if zero
+	Tabs     bool // indent with tabs instead of spaces
+}
+
+// Source re-indents the Python source src with 4 spaces per level
+// and returns the result, as reindent.py does.
+// If src cannot be tokenized, for example because a string is not
+// terminated or a dedent does not match an outer indentation level,
+// Source returns an *Error. (reindent.py leaves unterminated strings
+// to the compiler to report, and may still re-indent the file.)
+func Source(src []byte) ([]byte, error) {
+	return new(Options).Source(src)
+}
+
+// Source is like the Source function, but indents as configured by o.
+// If o.Tabs is set, each level is indented with a tab, and leading
+// spaces of continuation lines are converted to tabs where they fill
+// a whole tab stop; lines inside multi-line strings are left with
+// spaces. Tabs in src are always read as Python reads them, with tab
+// stops every 8 columns, whatever o.TabWidth is.
+func (o *Options) Source(src []byte) ([]byte, error) {
+	width, tabWidth := o.Width, o.TabWidth
+	if tabWidth <= 0 {
+		tabWidth = 8
+	}
+	if o.Tabs {
+		width = tabWidth
+	}
+	if width <= 0 {
+		width = 4
+	}
+	lines := splitLines(src)
+	stats, inString, err := scan(lines)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	crlf := len(lines) > 1 && bytes.HasSuffix(firstLine(src), []byte("\r\n"))
+	for i, line := range reindent(lines, stats, width) {
+		if o.Tabs && !inString[i+1] {
+			line = tabify(line, tabWidth)
+		}
+		if crlf {
+			line = strings.TrimSuffix(line, "\n") + "\r\n"
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes(), nil
+}
+
+func firstLine(src []byte) []byte {
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		return src[:i+1]
+	}
+	return src
+}
+
+// splitLines splits src into lines, with trailing whitespace removed,
+// tabs expanded to tab stops every 8 columns and a newline added to
+// each line. The first element of the result is unused so that lines
+// are indexed from 1.
+func splitLines(src []byte) []string {
+	lines := []string{""}
+	for len(src) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line, src = src[:i], src[i+1:]
+		} else {
+			line, src = src, nil
+		}
+		line = bytes.TrimRight(bytes.TrimSuffix(line, []byte("\r")), " \t")
+		lines = append(lines, expandTabs(line, 8)+"\n")
+	}
+	return lines
+}
+
+// expandTabs replaces the tabs in line with spaces, using tab stops
+// every tabWidth columns.
+func expandTabs(line []byte, tabWidth int) string {
+	if bytes.IndexByte(line, '\t') < 0 {
+		return string(line)
+	}
+	var b strings.Builder
+	col := 0
+	for len(line) > 0 {
+		r, n := utf8.DecodeRune(line)
+		line = line[n:]
+		if r == '\t' {
+			n := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+// tabify replaces the leading spaces of line with tabs, keeping any
+// spaces that do not fill a whole tab stop.
+func tabify(line string, tabWidth int) string {
+	n := lspace(line)
+	return strings.Repeat("\t", n/tabWidth) + line[n-n%tabWidth:]
+}
+
+// A stat records the first line of a statement, or of a comment
+// preceding a statement, and its indentation level. The level of a
+// comment is -1.
+type stat struct {
+	line, level int
+}
+
+// lspace returns the number of leading spaces in line.
+func lspace(line string) int {
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// reindent returns the re-indented lines, following the algorithm of
+// reindent.py with width columns per indentation level.
+func reindent(lines []string, stats []stat, width int) []string {
+	for len(lines) > 1 && lines[len(lines)-1] == "\n" {
+		lines = lines[:len(lines)-1]
+	}
+	stats = append(stats, stat{len(lines), 0}) // sentinel
+
+	// Map count of leading spaces to the number we want.
+	have2want := make(map[int]int)
+
+	// Copy over initial empty lines; there's nothing to do until
+	// we see a line with something on it.
+	after := append([]string(nil), lines[1:min(stats[0].line, len(lines))]...)
+
+	for i := 0; i < len(stats)-1; i++ {
+		this, next := stats[i].line, stats[i+1].line
+		have := lspace(lines[this])
+		want := stats[i].level * width
+		if want < 0 {
+			// A comment line.
+			want = commentIndent(lines, after, stats, i, width, have, have2want)
+		}
+		have2want[have] = want
+		diff := want - have
+		block := lines[this:min(next, len(lines))]
+		if diff == 0 || have == 0 {
+			after = append(after, block...)
+			continue
+		}
+		for _, line := range block {
+			switch {
+			case diff > 0 && line == "\n":
+				after = append(after, line)
+			case diff > 0:
+				after = append(after, strings.Repeat(" ", diff)+line)
+			default:
+				after = append(after, line[min(lspace(line), -diff):])
+			}
+		}
+	}
+	return after
+}
+
+// commentIndent returns the indentation wanted for the comment line
+// of stats[i], which has the given number of leading spaces.
+func commentIndent(lines, after []string, stats []stat, i, width, have int, have2want map[int]int) int {
+	if have == 0 {
+		return 0
+	}
+	// An indented comment line. If we saw the same indentation
+	// before, reuse what it most recently mapped to.
+	if want, ok := have2want[have]; ok {
+		return want
+	}
+	// Then it probably belongs to the next real statement.
+	for _, s := range stats[i+1 : len(stats)-1] {
+		if s.level >= 0 {
+			if have == lspace(lines[s.line]) {
+				return s.level * width
+			}
+			break
+		}
+	}
+	// Maybe it's a hanging comment like this one,
+	// in which case we should shift it like its base
+	// line got shifted.
+	for j := i - 1; j >= 0; j-- {
+		if s := stats[j]; s.level >= 0 {
+			if want := have + lspace(after[s.line-1]) - lspace(lines[s.line]); want >= 0 {
+				return want
+			}
+			break
+		}
+	}
+	// Still no luck; leave it alone.
+	return have
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,112 @@
+package reindent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGolden re-indents each testdata/*.in file and compares the
+// result with its .golden file, or the error with its .err file.
+// These files are not upstream test cases: they were written by hand
+// and checked against what reindent.py's Reindenter makes of the .in
+// files.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test files")
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := strings.TrimSuffix(file, ".in")
+		got, err := Source(src)
+		if err != nil {
+			want, rerr := ioutil.ReadFile(base + ".err")
+			if rerr != nil {
+				t.Errorf("%s: unexpected error: %v", file, err)
+				continue
+			}
+			if msg := strings.TrimSpace(string(want)); err.Error() != msg {
+				t.Errorf("%s: error is %q; expected %q", file, err, msg)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(base + ".golden")
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got\n%s\nexpected\n%s", file, got, want)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Source(src)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("%s: reindenting changed the file:\n%s", file, got)
+		}
+	}
+}
+
+var optionsTests = []struct {
+	opts     Options
+	src, out string
+}{
+	{
+		Options{Width: 2},
+		"if x:\n    y = 1\n    # comment\n    z = (1,\n         2)\n",
+		"if x:\n  y = 1\n  # comment\n  z = (1,\n       2)\n",
+	},
+	{
+		Options{Tabs: true, TabWidth: 4},
+		"def f():\n  s = \"\"\"a\n      b\"\"\"\n  return (1,\n          2)\n",
+		"def f():\n\ts = \"\"\"a\n        b\"\"\"\n\treturn (1,\n\t\t\t2)\n",
+	},
+	{
+		// A tab is read as 8 columns, even when writing narrower tabs.
+		Options{Tabs: true, TabWidth: 2},
+		"if x:\n\ty = 1\n        z = (1,\n\t     2)\n",
+		"if x:\n\ty = 1\n\tz = (1,\n\t\t\t 2)\n",
+	},
+	{
+		Options{Width: 2},
+		"if x:\n\ty = 1\n        z = 2\n",
+		"if x:\n  y = 1\n  z = 2\n",
+	},
+}
+
+func TestOptions(t *testing.T) {
+	for _, tt := range optionsTests {
+		out, err := tt.opts.Source([]byte(tt.src))
+		if err != nil {
+			t.Errorf("%+v.Source(%q) failed: %v", tt.opts, tt.src, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("%+v.Source(%q) = %q; expected %q", tt.opts, tt.src, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package reindent
+
+import "strings"
+
+// A scanner tokenizes just enough Python to find where statements
+// start and how deeply they are indented. It follows the structure
+// of the tokenize module in the Python standard library.
+type scanner struct {
+	parenlev  int   // nesting depth of brackets
+	continued bool  // previous line ended with a backslash
+	indents   []int // columns of the enclosing indentation levels
+	level     int   // current indentation level
+
+	// String continued from a previous line.
+	strEnd   string // closing quote, or "" if not in a string
+	strStart int    // line where the string started
+
+	findStmt bool // the next real token starts a statement
+	stats    []stat
+	inString []bool // whether each line starts inside a string
+}
+
+// scan tokenizes lines and returns the statement and comment lines
+// found, in the form expected by reindent, and which lines start
+// inside a multi-line string.
+func scan(lines []string) ([]stat, []bool, error) {
+	s := &scanner{
+		indents:  []int{0},
+		findStmt: true,
+		inString: make([]bool, len(lines)),
+	}
+	for lnum := 1; lnum < len(lines); lnum++ {
+		s.inString[lnum] = s.strEnd != ""
+		if err := s.scanLine(lnum, lines[lnum]); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch {
+	case s.strEnd != "":
+		return nil, nil, &Error{s.strStart, "EOF in multi-line string"}
+	case s.parenlev > 0 || s.continued:
+		return nil, nil, &Error{len(lines), "EOF in multi-line statement"}
+	}
+	return s.stats, s.inString, nil
+}
+
+// The token handlers below correspond to the cases of
+// Reindenter.tokeneater in reindent.py.
+
+func (s *scanner) newline() { s.findStmt = true }
+
+func (s *scanner) indent() {
+	s.findStmt = true
+	s.level++
+}
+
+func (s *scanner) dedent() {
+	s.findStmt = true
+	s.level--
+}
+
+func (s *scanner) comment(lnum int) {
+	if s.findStmt {
+		// But we're still looking for a new statement,
+		// so leave findStmt alone.
+		s.stats = append(s.stats, stat{lnum, -1})
+	}
+}
+
+// token handles any token that is not a newline, comment or change
+// of indentation.
+func (s *scanner) token(lnum int) {
+	if s.findStmt {
+		// This is the first real token following a newline,
+		// so it must be the first token of the next statement.
+		s.findStmt = false
+		s.stats = append(s.stats, stat{lnum, s.level})
+	}
+}
+
+func (s *scanner) scanLine(lnum int, line string) error {
+	pos := 0
+	switch {
+	case s.strEnd != "":
+		end, ok := scanString(line, 0, s.strEnd)
+		if !ok {
+			if end < len(line) {
+				return &Error{s.strStart, "EOL while scanning string literal"}
+			}
+			return nil
+		}
+		pos = end
+		s.strEnd = ""
+		s.token(s.strStart)
+
+	case s.parenlev == 0 && !s.continued:
+		// A new statement.
+		var column int
+		pos, column = indentation(line)
+		if pos == len(line) || line[pos] == '\n' || line[pos] == '\r' {
+			return nil // blank line
+		}
+		if line[pos] == '#' {
+			s.comment(lnum)
+			return nil
+		}
+		if column > s.indents[len(s.indents)-1] {
+			s.indents = append(s.indents, column)
+			s.indent()
+		}
+		for column < s.indents[len(s.indents)-1] {
+			if !containsInt(s.indents, column) {
+				return &Error{lnum, "unindent does not match any outer indentation level"}
+			}
+			s.indents = s.indents[:len(s.indents)-1]
+			s.dedent()
+		}
+
+	default:
+		// A continued statement.
+		s.continued = false
+	}
+
+	for pos < len(line) {
+		c := line[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\f':
+			pos++
+		case c == '\n' || c == '\r':
+			if s.parenlev == 0 {
+				s.newline()
+			}
+			return nil
+		case c == '#':
+			s.comment(lnum)
+			return nil
+		case c == '\\' && (line[pos+1:] == "\n" || line[pos+1:] == "\r\n"):
+			s.continued = true
+			return nil
+		case c == '\'' || c == '"':
+			var err error
+			if pos, err = s.scanStringToken(lnum, line, pos); err != nil || s.strEnd != "" {
+				return err
+			}
+		case isIdentStart(c):
+			start := pos
+			for pos < len(line) && isIdent(line[pos]) {
+				pos++
+			}
+			if pos < len(line) && (line[pos] == '\'' || line[pos] == '"') && isStringPrefix(line[start:pos]) {
+				var err error
+				if pos, err = s.scanStringToken(lnum, line, pos); err != nil || s.strEnd != "" {
+					return err
+				}
+				continue
+			}
+			s.token(lnum)
+		case isDigit(c) || c == '.' && pos+1 < len(line) && isDigit(line[pos+1]):
+			for pos < len(line) {
+				if c := line[pos]; (c == 'e' || c == 'E') && pos+1 < len(line) && (line[pos+1] == '+' || line[pos+1] == '-') {
+					pos += 2
+				} else if isIdent(c) || c == '.' {
+					pos++
+				} else {
+					break
+				}
+			}
+			s.token(lnum)
+		default:
+			switch c {
+			case '(', '[', '{':
+				s.parenlev++
+			case ')', ']', '}':
+				s.parenlev--
+			}
+			pos++
+			s.token(lnum)
+		}
+	}
+	return nil
+}
+
+// scanStringToken scans the string literal whose opening quote is at
+// line[pos] and returns the position following it. If the literal
+// continues on the next line, it records it in s.strEnd.
+func (s *scanner) scanStringToken(lnum int, line string, pos int) (int, error) {
+	quote := line[pos : pos+1]
+	if strings.HasPrefix(line[pos:], quote+quote+quote) {
+		quote = quote + quote + quote
+	}
+	end, ok := scanString(line, pos+len(quote), quote)
+	if ok {
+		s.token(lnum)
+		return end, nil
+	}
+	if end < len(line) {
+		return 0, &Error{lnum, "EOL while scanning string literal"}
+	}
+	s.strEnd = quote
+	s.strStart = lnum
+	return len(line), nil
+}
+
+// scanString looks for the closing quote of a string in line,
+// starting at pos. It returns the position following the quote, and
+// whether it was found. If a single-quoted string is not closed
+// before an unescaped newline, the position returned is that of the
+// newline.
+func scanString(line string, pos int, quote string) (int, bool) {
+	for pos < len(line) {
+		switch {
+		case line[pos] == '\\':
+			pos += 2
+		case strings.HasPrefix(line[pos:], quote):
+			return pos + len(quote), true
+		case len(quote) == 1 && line[pos] == '\n':
+			return pos, false
+		default:
+			pos++
+		}
+	}
+	return pos, false
+}
+
+// indentation returns the position of the first non-blank character
+// in line and its column.
+func indentation(line string) (pos, column int) {
+	for ; pos < len(line); pos++ {
+		switch line[pos] {
+		case ' ':
+			column++
+		case '\t':
+			column = (column/8 + 1) * 8
+		case '\f':
+			column = 0
+		default:
+			return pos, column
+		}
+	}
+	return pos, column
+}
+
+func isStringPrefix(s string) bool {
+	switch strings.ToLower(s) {
+	case "r", "u", "b", "f", "br", "rb", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func containsInt(a []int, x int) bool {
+	for _, y := range a {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// rootMarkers are files found at the top of a Python project.
+var rootMarkers = []string{"pyproject.toml", "setup.py", "setup.cfg", "tox.ini", "pytest.ini", ".git"}
+
+// projectRoot returns the top directory of the Python project
+// containing dir, or dir itself if it doesn't seem to be in one.
+func projectRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		for _, m := range rootMarkers {
+			if _, err := os.Stat(filepath.Join(d, m)); err == nil {
+				return d
+			}
+		}
+		if d == filepath.Dir(d) {
+			return dir
+		}
+	}
+}
+
+// findTests returns the test files for the named Python file. Each
+// pattern is a file name relative to the file's directory, in which
+// %s stands for the file's base name without the .py suffix. A file
+// that is itself a test is its own test.
+func findTests(name string, patterns []string) []string {
+	dir, base := filepath.Split(name)
+	mod := strings.TrimSuffix(base, filepath.Ext(base))
+	if strings.HasPrefix(mod, "test_") || strings.HasSuffix(mod, "_test") {
+		return []string{name}
+	}
+	var tests []string
+	for _, pat := range patterns {
+		pat = strings.TrimSpace(pat)
+		if pat == "" {
+			continue
+		}
+		test := filepath.Join(dir, strings.Replace(pat, "%s", mod, -1))
+		if _, err := os.Stat(test); err == nil {
+			tests = append(tests, test)
+		}
+	}
+	return tests
+}
+
+// A testRun is a test file being run.
+type testRun struct {
+	cancel context.CancelFunc
+}
+
+// A tester runs tests in the background. Starting a test file that
+// is already running cancels the earlier run.
+type tester struct {
+	runner   string
+	patterns []string
+
+	mu      sync.Mutex
+	running map[string]*testRun // by test file
+	failed  map[string]bool     // test files that failed last time
+}
+
+func newTester(runner string, patterns []string) *tester {
+	return &tester{
+		runner:   runner,
+		patterns: patterns,
+		running:  make(map[string]*testRun),
+		failed:   make(map[string]bool),
+	}
+}
+
+// put starts the tests for the named file, which was just written.
+func (t *tester) put(name string) {
+	for _, test := range findTests(name, t.patterns) {
+		t.start(test)
+	}
+}
+
+func (t *tester) start(test string) {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	r := &testRun{cancel: cancel}
+	t.mu.Lock()
+	if old := t.running[test]; old != nil {
+		old.cancel()
+	}
+	t.running[test] = r
+	t.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		report, failed := t.run(ctx, test)
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.running[test] != r {
+			return // superseded
+		}
+		delete(t.running, test)
+		if ctx.Err() == context.DeadlineExceeded {
+			report, failed = fmt.Sprintf("%s: timed out after %v\n", test, *timeout), true
+		}
+		if !failed && t.failed[test] {
+			report = fmt.Sprintf("%s: tests pass\n", test)
+		}
+		t.failed[test] = failed
+		if report != "" {
+			acme.Err(test, report)
+		}
+	}()
+}
+
+// run runs the test file and returns a summary of the failures, and
+// whether there were any.
+func (t *tester) run(ctx context.Context, test string) (string, bool) {
+	root := projectRoot(filepath.Dir(test))
+	rel, err := filepath.Rel(root, test)
+	if err != nil {
+		return err.Error(), true
+	}
+	var cmd *exec.Cmd
+	switch t.runner {
+	case "unittest":
+		mod := strings.Replace(strings.TrimSuffix(rel, ".py"), string(filepath.Separator), ".", -1)
+		cmd = exec.CommandContext(ctx, "python3", "-m", "unittest", mod)
+	default:
+		cmd = exec.CommandContext(ctx, "python3", "-m", "pytest", "-q", "--tb=line", "--color=no", "-p", "no:cacheprovider", rel)
+	}
+	cmd.Dir = root
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return "", false
+	}
+	if err == nil {
+		return "", false
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return fmt.Sprintf("%s: %v\n", test, err), true
+	}
+	if t.runner == "unittest" {
+		return summarizeUnittest(out, root), true
+	}
+	if cmd.ProcessState.ExitCode() == 5 {
+		return "", false // no tests collected
+	}
+	return summarizePytest(out, root), true
+}
+
+// PytestRef matches a failure reported by pytest --tb=line.
+var PytestRef = regexp.MustCompile(`^(.+\.py):([0-9]+): (.*)$`)
+
+// summarizePytest returns the failures in the output of pytest, one
+// line each, with file names made absolute using the directory root
+// in which pytest ran. If no failures are found, the output is
+// returned with its tracebacks rewritten.
+func summarizePytest(out []byte, root string) string {
+	var buf bytes.Buffer
+	var last string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if m := PytestRef.FindStringSubmatch(line); m != nil {
+			file := m[1]
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(root, file)
+			}
+			fmt.Fprintf(&buf, "%s:%s: %s\n", file, m[2], m[3])
+		}
+		if strings.TrimSpace(line) != "" {
+			last = line
+		}
+	}
+	if buf.Len() == 0 {
+		buf.Reset()
+		filterTraceback(&buf, bytes.NewReader(out), "")
+		return buf.String()
+	}
+	return buf.String() + strings.Trim(last, "= ") + "\n"
+}
+
+// summarizeUnittest returns the failures in the output of unittest:
+// for each failed test, its name, the traceback frames as plumbable
+// addresses, and the exception, followed by the final summary.
+func summarizeUnittest(out []byte, root string) string {
+	var buf bytes.Buffer
+	var exc, last string
+	inFailure := false
+	flush := func() {
+		if exc != "" {
+			fmt.Fprintf(&buf, "\t%s\n", exc)
+			exc = ""
+		}
+	}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "FAIL: ") || strings.HasPrefix(line, "ERROR: "):
+			flush()
+			inFailure = true
+			fmt.Fprintf(&buf, "%s\n", line)
+		case strings.HasPrefix(line, "Ran ") || strings.HasPrefix(line, "FAILED ") || line == "OK":
+			flush()
+			inFailure = false
+			last = line
+		case !inFailure:
+		case LineRef.MatchString(line):
+			if m := LineRef.FindStringSubmatch(line); !filepath.IsAbs(m[1]) {
+				line = strings.Replace(line, m[1], filepath.Join(root, m[1]), 1)
+			}
+			fmt.Fprintf(&buf, "%s\n", rewriteTraceback(line, ""))
+		case line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "---") ||
+			strings.HasPrefix(line, "===") || strings.HasPrefix(line, "Traceback "):
+		default:
+			if exc == "" {
+				exc = line
+			}
+		}
+	}
+	flush()
+	if last != "" {
+		fmt.Fprintf(&buf, "%s\n", last)
+	}
+	return buf.String()
+}
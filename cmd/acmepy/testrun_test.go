@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"calc.py", "test_calc.py", "calc_test.py", "tests/test_calc.py", "other.py"} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patterns := []string{"test_%s.py", " %s_test.py", "", "tests/test_%s.py"}
+	tests := []struct {
+		name  string
+		tests []string
+	}{
+		{"calc.py", []string{"test_calc.py", "calc_test.py", "tests/test_calc.py"}},
+		{"test_calc.py", []string{"test_calc.py"}},
+		{"calc_test.py", []string{"calc_test.py"}},
+		{"other.py", nil},
+	}
+	for _, tt := range tests {
+		var want []string
+		for _, test := range tt.tests {
+			want = append(want, filepath.Join(dir, test))
+		}
+		if got := findTests(filepath.Join(dir, tt.name), patterns); !reflect.DeepEqual(got, want) {
+			t.Errorf("findTests(%q) = %q; expected %q", tt.name, got, want)
+		}
+	}
+}
+
+var summarizeTests = []struct {
+	name      string
+	summarize func(out []byte, root string) string
+	out, want string
+}{
+	{
+		"pytest failures",
+		summarizePytest,
+		`FF.                                                                      [100%]
+/proj/test_calc.py:7: AssertionError: -1 != 3
+pkg/test_x.py:10: ValueError: boom
+=========================== short test summary info ============================
+FAILED test_calc.py::T::test_add - AssertionError: -1 != 3
+FAILED pkg/test_x.py::test_err - ValueError: boom
+2 failed, 1 passed in 0.03s
+`,
+		`/proj/test_calc.py:7: AssertionError: -1 != 3
+/proj/pkg/test_x.py:10: ValueError: boom
+2 failed, 1 passed in 0.03s
+`,
+	},
+	{
+		"pytest without failures",
+		summarizePytest,
+		`ImportError while loading conftest '/proj/conftest.py'.
+Traceback (most recent call last):
+  File "/proj/conftest.py", line 3, in <module>
+    import missing
+ModuleNotFoundError: No module named 'missing'
+`,
+		`ImportError while loading conftest '/proj/conftest.py'.
+Traceback (most recent call last):
+  /proj/conftest.py:3 in <module>
+    import missing
+ModuleNotFoundError: No module named 'missing'
+`,
+	},
+	{
+		"unittest",
+		summarizeUnittest,
+		`FE.
+======================================================================
+ERROR: test_err (test_calc.T.test_err)
+----------------------------------------------------------------------
+Traceback (most recent call last):
+  File "/proj/test_calc.py", line 10, in test_err
+    raise ValueError("boom")
+ValueError: boom
+
+======================================================================
+FAIL: test_add (test_calc.T.test_add)
+----------------------------------------------------------------------
+Traceback (most recent call last):
+  File "test_calc.py", line 7, in test_add
+    self.assertEqual(add(1, 2), 3)
+AssertionError: -1 != 3
+
+----------------------------------------------------------------------
+Ran 3 tests in 0.001s
+
+FAILED (failures=1, errors=1)
+`,
+		`ERROR: test_err (test_calc.T.test_err)
+  /proj/test_calc.py:10 in test_err
+	ValueError: boom
+FAIL: test_add (test_calc.T.test_add)
+  /proj/test_calc.py:7 in test_add
+	AssertionError: -1 != 3
+FAILED (failures=1, errors=1)
+`,
+	},
+}
+
+func TestSummarize(t *testing.T) {
+	for _, tt := range summarizeTests {
+		if got := tt.summarize([]byte(tt.out), "/proj"); got != tt.want {
+			t.Errorf("%s: got\n%s\nexpected\n%s", tt.name, got, tt.want)
+		}
+	}
+}
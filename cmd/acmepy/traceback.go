@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// rewriteTraceback rewrites a line of Python traceback output that
+// matches LineRef, such as
+//
+//	File "/home/gopher/src/x.py", line 12, in main
+//
+// into a plumbable address, keeping the function name:
+//
+//	src/x.py:12 in main
+//
+// If dir is not empty, file names below it are made relative to it.
+// File names containing spaces are quoted, as in 'my proj/x.py':3, so
+// that acme sees the whole address. Other lines are returned
+// unchanged.
+func rewriteTraceback(line, dir string) string {
+	m := LineRef.FindStringSubmatchIndex(line)
+	if m == nil {
+		return line
+	}
+	file, lnum := line[m[2]:m[3]], line[m[4]:m[5]]
+	if strings.HasPrefix(file, "<") {
+		return line // e.g. <frozen importlib._bootstrap> or <stdin>
+	}
+	if dir != "" && filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(dir, file); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			file = rel
+		}
+	}
+	if strings.ContainsAny(file, " \t") {
+		file = "'" + strings.Replace(file, "'", "''", -1) + "'"
+	}
+	addr := file + ":" + lnum
+	if m[6] >= 0 {
+		addr += " in " + line[m[6]:m[7]]
+	}
+	return line[:m[0]] + addr + line[m[1]:]
+}
+
+// filterTraceback copies r to w, rewriting traceback lines with
+// rewriteTraceback. Each line is written as soon as it is read.
+func filterTraceback(w io.Writer, r io.Reader, dir string) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			nl := strings.HasSuffix(line, "\n")
+			line = rewriteTraceback(strings.TrimSuffix(line, "\n"), dir)
+			if nl {
+				line += "\n"
+			}
+			if _, werr := io.WriteString(w, line); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
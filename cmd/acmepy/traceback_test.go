@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var tracebackTests = []struct {
+	in, out string
+}{
+	{`  File "/home/gopher/src/x.py", line 12, in main`, `  src/x.py:12 in main`},
+	{`  File "/home/gopher/my proj/naïve.py", line 3, in <module>`, `  'my proj/naïve.py':3 in <module>`},
+	{`  File "/home/gopher/it's here/a.py", line 1, in f`, `  'it''s here/a.py':1 in f`},
+	{`  File "/home/gopher/..cfg/x.py", line 5, in f`, `  ..cfg/x.py:5 in f`},
+	{`  File "/home/x.py", line 5, in f`, `  /home/x.py:5 in f`},
+	{`  File "/usr/lib/python3/json/__init__.py", line 346, in loads`, `  /usr/lib/python3/json/__init__.py:346 in loads`},
+	{`  File "rel/y.py", line 7`, `  rel/y.py:7`},
+	{`  File "<frozen importlib._bootstrap>", line 241, in _call`, `  File "<frozen importlib._bootstrap>", line 241, in _call`},
+	{`Traceback (most recent call last):`, `Traceback (most recent call last):`},
+}
+
+func TestRewriteTraceback(t *testing.T) {
+	for _, tt := range tracebackTests {
+		if out := rewriteTraceback(tt.in, "/home/gopher"); out != tt.out {
+			t.Errorf("rewriteTraceback(%q) = %q; expected %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestFilterTraceback(t *testing.T) {
+	in := "Traceback (most recent call last):\n  File \"/d/a.py\", line 2, in f\nValueError"
+	want := "Traceback (most recent call last):\n  a.py:2 in f\nValueError"
+	var out bytes.Buffer
+	if err := filterTraceback(&out, strings.NewReader(in), "/d"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("filterTraceback output is %q; expected %q", out.String(), want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+// debounce is how long a worker waits after a put before starting,
+// so that a burst of puts is handled once.
+const debounce = 100 * time.Millisecond
+
+// A worker formats the file of a single acme window. Puts that arrive
+// while the worker is busy cancel the job in progress, and only the
+// latest of them is handled.
+//
+// With -preview, the worker also reads the window's events, so that
+// the Acmepy command can be executed in the window; other events are
+// passed back to acme. Otherwise the event file is left to other
+// programs.
+type worker struct {
+	id   int
+	wake chan struct{}
+	quit chan struct{}
+
+	mu      sync.Mutex
+	file    string             // file name of the window
+	name    string             // file name of the pending put, if any
+	cancel  context.CancelFunc // cancels the running job
+	preview bool               // show changes instead of making them
+}
+
+func newWorker(id int, file string) *worker {
+	w := &worker{
+		id:      id,
+		file:    file,
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		preview: *previewFlag,
+	}
+	go w.loop()
+	if *previewFlag {
+		go w.events()
+	}
+	return w
+}
+
+// put schedules the file name to be formatted, superseding any
+// pending or running job.
+func (w *worker) put(name string) {
+	w.mu.Lock()
+	w.file = name
+	w.name = name
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop cancels the running job and makes the worker exit.
+func (w *worker) stop() {
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.mu.Unlock()
+	close(w.quit)
+}
+
+func (w *worker) loop() {
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-w.wake:
+		}
+		select {
+		case <-w.quit:
+			return
+		case <-time.After(debounce):
+		}
+
+		w.mu.Lock()
+		name := w.name
+		w.name = ""
+		preview := w.preview
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		w.cancel = cancel
+		w.mu.Unlock()
+
+		if name != "" {
+			process(ctx, w.id, name, preview)
+			if ctx.Err() == context.DeadlineExceeded {
+				log.Printf("%s: timed out after %v", name, *timeout)
+			}
+		}
+		cancel()
+	}
+}
+
+// events handles the events of the worker's window until it is deleted.
+func (w *worker) events() {
+	win, err := acme.Open(w.id, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer win.CloseFiles()
+	if err := win.OpenEvent(); err != nil {
+		// Perhaps another program is handling the window.
+		log.Printf("window %d: %v", w.id, err)
+		return
+	}
+	win.EventLoop(w)
+}
+
+// ExecAcmepy handles the Acmepy command executed in the window.
+// "Acmepy preview" toggles preview mode.
+func (w *worker) ExecAcmepy(arg string) {
+	w.mu.Lock()
+	file := w.file
+	var msg string
+	switch arg {
+	case "preview":
+		w.preview = !w.preview
+		if w.preview {
+			msg = "preview mode on"
+		} else {
+			msg = "preview mode off"
+		}
+	default:
+		msg = fmt.Sprintf("unknown command %q; usage: Acmepy preview", arg)
+	}
+	w.mu.Unlock()
+	acme.Errf(file, "acmepy: %s: %s", file, msg)
+}
+
+func (w *worker) Execute(cmd string) bool { return false }
+func (w *worker) Look(arg string) bool    { return false }
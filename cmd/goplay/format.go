@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+	"golang.org/x/tools/imports"
+	"golang.org/x/tools/txtar"
+)
+
+// formatSource formats src, the contents of the named file, and the Go
+// files it holds if it is a txtar archive, with gofmt. If fixImports
+// is set, it also adds missing imports and removes unused ones, like
+// goimports.
+func formatSource(name string, src []byte, fixImports bool) ([]byte, error) {
+	ar := txtar.Parse(src)
+	if len(ar.Files) == 0 {
+		return formatFile(name, src, fixImports)
+	}
+	var err error
+	if len(bytes.TrimSpace(ar.Comment)) > 0 {
+		if ar.Comment, err = formatFile(name, ar.Comment, fixImports); err != nil {
+			return nil, err
+		}
+	}
+	for i, f := range ar.Files {
+		if strings.HasSuffix(f.Name, ".go") {
+			if ar.Files[i].Data, err = formatFile(f.Name, f.Data, fixImports); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return txtar.Format(ar), nil
+}
+
+func formatFile(name string, src []byte, fixImports bool) ([]byte, error) {
+	return imports.Process(name, src, &imports.Options{
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   8,
+		FormatOnly: !fixImports,
+	})
+}
+
+// fixWindow formats the named Go file in window id and fixes its
+// imports. If that changes it, fixWindow makes the changes in the
+// window body, calls beforePut, writes the window, and returns true.
+// Files that don't parse are left alone, for the compiler to report.
+// Fixing imports may look through the module cache at length and
+// cannot be interrupted, so fixWindow gives up on it, leaving the
+// window alone, once ctx is done.
+func fixWindow(ctx context.Context, id int, name string, beforePut func()) bool {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return false
+	}
+	defer w.CloseFiles()
+	old, err := w.ReadAll("body")
+	if err != nil {
+		return false
+	}
+	type result struct {
+		src []byte
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		new, err := formatSource(name, old, true)
+		c <- result{new, err}
+	}()
+	var new []byte
+	select {
+	case <-ctx.Done():
+		return false
+	case res := <-c:
+		if res.err != nil || bytes.Equal(old, res.src) {
+			return false
+		}
+		new = res.src
+	}
+
+	// Replace only the lines that changed, so that the window
+	// keeps its place and the undo history stays small.
+	oldLines := strings.SplitAfter(string(old), "\n")
+	newLines := strings.SplitAfter(string(new), "\n")
+	p := 0
+	for p < len(oldLines) && p < len(newLines) && oldLines[p] == newLines[p] {
+		p++
+	}
+	q := 0
+	for q < len(oldLines)-p && q < len(newLines)-p && oldLines[len(oldLines)-1-q] == newLines[len(newLines)-1-q] {
+		q++
+	}
+	start := utf8.RuneCountInString(strings.Join(oldLines[:p], ""))
+	end := start + utf8.RuneCountInString(strings.Join(oldLines[p:len(oldLines)-q], ""))
+	if err := w.Addr("#%d,#%d", start, end); err != nil {
+		return false
+	}
+	w.Write("data", []byte(strings.Join(newLines[p:len(newLines)-q], "")))
+	beforePut()
+	w.Ctl("put")
+	return true
+}
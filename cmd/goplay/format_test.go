@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+var formatSourceTests = []struct {
+	name       string
+	in, out    string
+	fixImports bool
+}{
+	{
+		"unchanged",
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		true,
+	},
+	{
+		"gofmt only",
+		"package main\nimport \"fmt\"\nfunc main() {\nfmt.Println( 1 )\n}\n",
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		true,
+	},
+	{
+		"missing import",
+		"package main\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+		"package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+		true,
+	},
+	{
+		"missing import kept",
+		"package main\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		"package main\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		false,
+	},
+	{
+		"unused import",
+		"package main\n\nimport \"os\"\n\nfunc main() {}\n",
+		"package main\n\nfunc main() {}\n",
+		true,
+	},
+	{
+		"txtar",
+		"package main\nfunc main() { b.F() }\n-- go.mod --\nmodule play\n-- b/b.go --\npackage b\nfunc F() {fmt.Println()}\n",
+		"package main\n\nfunc main() { b.F() }\n-- go.mod --\nmodule play\n-- b/b.go --\npackage b\n\nimport \"fmt\"\n\nfunc F() { fmt.Println() }\n",
+		true,
+	},
+}
+
+func TestFormatSource(t *testing.T) {
+	// Fixing imports looks at the module of the current directory;
+	// keep it away from goplay's own.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, tt := range formatSourceTests {
+		out, err := formatSource("a.go", []byte(tt.in), tt.fixImports)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("%s: got\n%s\nexpected\n%s", tt.name, out, tt.out)
+		}
+	}
+	if _, err := formatSource("a.go", []byte("package main\nfunc main() {\n"), true); err == nil {
+		t.Errorf("formatSource of a file that does not parse succeeded")
+	}
+}
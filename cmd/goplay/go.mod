@@ -1,5 +1,12 @@
 module github.com/fhs/misc/cmd/goplay
 
-go 1.11
+go 1.22.0
 
-require 9fans.net/go v0.0.2
+require (
+	9fans.net/go v0.0.2
+	golang.org/x/mod v0.21.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/tools v0.26.0
+)
+
+require golang.org/x/sync v0.11.0 // indirect
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyDir is the directory, relative to the playground, holding the
+// history of its runs: a numbered directory per run, with the source
+// files run in src, the standard input in stdin, the output shown in
+// output, and a record of the run in run.json.
+const historyDir = ".goplay/history"
+
+// maxRuns is the number of runs kept in the history; older runs are
+// removed as new ones are added.
+const maxRuns = 100
+
+// A record describes a run in the history.
+type record struct {
+	Mode     string
+	Time     time.Time
+	Duration time.Duration
+	ExitCode int // -1 if the program was killed or never ran
+	Status   string
+}
+
+// runDir returns the directory of run n in the history of the
+// playground dir.
+func runDir(dir string, n int) string {
+	return filepath.Join(dir, historyDir, fmt.Sprintf("%04d", n))
+}
+
+// listRuns returns the numbers of the runs in the history of the
+// playground dir, in order.
+func listRuns(dir string) ([]int, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(dir, historyDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []int
+	for _, fi := range fis {
+		if n, err := strconv.Atoi(fi.Name()); err == nil && fi.IsDir() {
+			runs = append(runs, n)
+		}
+	}
+	sort.Ints(runs)
+	return runs, nil
+}
+
+// snapshot copies the source files of the playground dir, that is all
+// its files outside .goplay but the ones unpacked from a.go by the
+// previous run, into a new run of its history, and returns the run's
+// directory. The unpacked files are left out since a.go holds them,
+// as they are in this run. The oldest runs are removed to keep at most
+// maxRuns.
+func snapshot(dir string) (string, error) {
+	runs, err := listRuns(dir)
+	if err != nil {
+		return "", err
+	}
+	n := 1
+	if len(runs) > 0 {
+		n = runs[len(runs)-1] + 1
+	}
+	for len(runs) >= maxRuns {
+		if err := os.RemoveAll(runDir(dir, runs[0])); err != nil {
+			return "", err
+		}
+		runs = runs[1:]
+	}
+	rd := runDir(dir, n)
+	unpacked := unpackedNames(dir)
+	err = filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && rel == ".goplay" {
+			return filepath.SkipDir
+		}
+		if !fi.Mode().IsRegular() || unpacked[filepath.ToSlash(rel)] {
+			return nil
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(rd, "src", rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, data, 0600)
+	})
+	if err != nil {
+		os.RemoveAll(rd)
+		return "", err
+	}
+	return rd, nil
+}
+
+// save writes the record, the standard input and the output of the
+// run whose directory is rd.
+func (r *record) save(rd string, stdin, output []byte) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(rd, "stdin"), stdin, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(rd, "output"), output, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(rd, "run.json"), append(data, '\n'), 0600)
+}
+
+// readRecord reads the record of run n of the playground dir.
+func readRecord(dir string, n int) (*record, error) {
+	data, err := ioutil.ReadFile(filepath.Join(runDir(dir, n), "run.json"))
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("run %d: %v", n, err)
+	}
+	return &r, nil
+}
+
+// history lists the runs of the playground dir, one per line, oldest
+// first. Runs still in progress have no record yet.
+func history(dir string) ([]byte, error) {
+	runs, err := listRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, n := range runs {
+		r, err := readRecord(dir, n)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(&b, "%d\t[running]\n", n)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%s\n", n, r.Time.Format("2006-01-02 15:04:05"), r.Mode, r.Status)
+	}
+	if b.Len() == 0 {
+		return []byte("no runs yet\n"), nil
+	}
+	return []byte(b.String()), nil
+}
+
+// parseRun parses the number of a run of the playground dir.
+func parseRun(dir, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad run %q", s)
+	}
+	if _, err := os.Stat(runDir(dir, n)); err != nil {
+		return 0, fmt.Errorf("no run %d", n)
+	}
+	return n, nil
+}
+
+// diffRuns returns the differences between the sources of two runs of
+// the playground dir, or between their outputs if args starts with
+// -o. The runs are given in args as "[-o] run1 run2".
+func diffRuns(dir, args string) ([]byte, error) {
+	f := strings.Fields(args)
+	what := "src"
+	if len(f) > 0 && f[0] == "-o" {
+		what = "output"
+		f = f[1:]
+	}
+	if len(f) != 2 {
+		return nil, fmt.Errorf("usage: Diff [-o] run1 run2")
+	}
+	var files [2]string
+	for i, s := range f {
+		n, err := parseRun(dir, s)
+		if err != nil {
+			return nil, err
+		}
+		files[i], _ = filepath.Rel(dir, filepath.Join(runDir(dir, n), what))
+	}
+	cmd := exec.Command("diff", "-ru", files[0], files[1])
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		err = nil // files differ
+	}
+	if err != nil {
+		return nil, fmt.Errorf("diff: %v", err)
+	}
+	if len(out) == 0 {
+		return []byte("no differences\n"), nil
+	}
+	return out, nil
+}
+
+// savedFile returns the contents of the named file of the playground
+// dir as it was in the run given by s.
+func savedFile(dir, name, s string) ([]byte, error) {
+	n, err := parseRun(dir, s)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(runDir(dir, n), "src", rel))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s not in run %d", rel, n)
+	}
+	return data, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"a.go":             "package main\n",
+		"sub/b.go":         "package sub\n",
+		"sub/c.go":         "package sub\n",
+		".goplay/mode":     "test\n",
+		".goplay/unpacked": "sub/c.go",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < maxRuns+5; i++ {
+		if _, err := snapshot(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := listRuns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != maxRuns || runs[0] != 6 || runs[len(runs)-1] != maxRuns+5 {
+		t.Errorf("history has runs %d to %d, %d in all; expected 6 to %d", runs[0], runs[len(runs)-1], len(runs), maxRuns+5)
+	}
+
+	rd := runDir(dir, runs[len(runs)-1])
+	if data, err := savedFile(dir, filepath.Join(dir, "sub/b.go"), filepath.Base(rd)); err != nil || string(data) != "package sub\n" {
+		t.Errorf("saved sub/b.go = %q, %v", data, err)
+	}
+	if exists(filepath.Join(rd, "src", "sub", "c.go")) {
+		t.Errorf("unpacked sub/c.go saved in history")
+	}
+	if exists(filepath.Join(rd, "src", ".goplay")) {
+		t.Errorf(".goplay saved in history")
+	}
+}
@@ -6,25 +6,221 @@
 
 // Goplay is a Go playground for acme(1).
 //
+// Usage:
+//
+//	goplay [-faketime] [-fmt=false] [-sandbox] [-s name] [-t template]
+//		[-timeout duration] [-go version | -gobin file | -compare toolchain,...]
+//	goplay -l
+//	goplay -rm name
+//	goplay [-cors origin] [-faketime] [-sandbox] [-timeout duration]
+//		-http address
+//	goplay -w [-faketime] [-sandbox] [-s name] [-t template]
+//		[-timeout duration] [-go version | -gobin file | -compare toolchain,...]
+//
 // Goplay uses the plumber to ask acme to open a temporary file,
 // and runs the file everytime Put is executed for that file. Once
 // the file's acme window is deleted, it removes the temporary file,
 // and exits.
 //
-// Run with acmego (http://godoc.org/code.google.com/p/rsc/cmd/acmego)
-// for import path rewriting.
+// When a Go file of the playground is written, goplay first formats
+// it and adds missing imports and removes unused ones, like
+// goimports. If that changes the file, goplay makes the changes in the
+// file's window and writes it again, which starts the run. The
+// -fmt=false flag turns this off.
+//
+// Before building, goplay adds the modules providing the packages
+// imported by the playground to its go.mod file, taking the latest
+// release found in the module cache, or the latest pre-release if
+// there is none, and nothing from the network (GOFLAGS=-mod=mod, with
+// the cache as GOPROXY), so third party packages can be used offline.
+// Checksum verification is turned off for this (GOSUMDB=off): the
+// go.sum lines come from the cache, whose modules were verified when
+// they were downloaded. The modules added, and the packages not found
+// in the cache, are reported in the output. The imports are looked up
+// again only when go.mod, go.sum or the imports of the Go files
+// change.
+//
+// The body of the playground's +goplay.stdin window is the standard
+// input of each run, for programs such as parsers and filters. It is
+// kept in sessions, and once the window is deleted, the standard
+// input is empty.
+//
+// The output of each run is shown in the playground's +goplay window,
+// which is cleared at the start of the run and ends with the exit
+// status and duration. File addresses in compiler errors, such as
+// ./a.go:5:2, are made absolute so they can be plumbed.
+//
+// Each program runs in the background, in its own process group, so
+// that servers and programs stuck in a loop don't hold up goplay. The
+// program is killed when the file is written again, to make way for
+// the new version, or once it has run for the duration given by the
+// -timeout flag, and the window says so.
+//
+// Programs are built into the .goplay subdirectory of the playground,
+// and programs and tests run in its run subdirectory, which is emptied
+// before each run and holds a link to the playground's testdata
+// directory, if any, so that the files they write do not start
+// another run. The -sandbox flag runs programs in a sandbox, for code
+// that is not trusted, such as snippets pasted from an issue tracker.
+// This needs Linux with unprivileged user namespaces: the program runs
+// in new user, network, mount and PID namespaces, with no network, no
+// other process in sight, the file system read-only except for the
+// playground directory, empty /tmp and /run/user directories and name
+// space directory, so that the unix sockets of acme, the plumber,
+// ssh-agent and the like cannot be reached, no environment variables
+// pointing at them, TMPDIR and HOME set to the run directory, and
+// limits of 10s of CPU time, 512MB of memory, 64 open files and 128
+// processes and threads.
+//
+// The -faketime flag builds programs with the faketime tag, like
+// play.golang.org does: time starts at 2009-11-10 23:00:00 UTC and
+// moves forward only when every goroutine is asleep, so programs
+// calling time.Sleep run at once and their output is reproducible,
+// for teaching or for golden outputs. Each write to standard output or
+// error is recorded with its fake time, and the output is replayed in
+// the +goplay window with the delays between the writes. With -http,
+// the replies to /compile hold those events and delays. Since the
+// output only shows once the program ends, programs are killed after
+// a minute unless -timeout says otherwise, or once they have written
+// 1MB. Faketime is not supported on Windows.
+//
+// Like on play.golang.org, a.go may hold several files in the txtar
+// format (see golang.org/x/tools/txtar), each introduced by a header
+// line such as
+//
+//	-- b.go --
+//
+// The text before the first header is a.go itself, and each file is
+// written into the playground before the run, replacing what was
+// there. This is the way to give other packages of the module, in
+// subdirectories, or a go.mod file of one's own. Files removed from
+// a.go are removed from the playground, and errors in the files are
+// reported at their lines in a.go.
+//
+// The -t flag names the template the playground starts from:
+//
+//	hello      the hello, world program (the default)
+//	test       a function and its test, run with go test -v
+//	benchmark  two functions and their benchmarks, run with go test -bench
+//	http       an HTTP server
+//	generics   generic functions
+//
+// User templates are directories in $XDG_CONFIG_HOME/goplay/templates
+// (~/.config/goplay/templates by default), named after the template,
+// whose files are copied into the playground. A .goplay/mode file in
+// a template says how to run it: run (the default), test, bench, or
+// any of the modes of the tag commands below, in lower case. The
+// playground's a.go and a_test.go files are opened in acme, and
+// writing any file of the playground runs it.
+//
+// The tags of the windows of the playground's Go files get commands
+// running it in other modes, once, without changing the mode used on
+// Put:
+//
+//	Run          build and run the program
+//	Test         run the tests with go test -v
+//	Vet          run go vet
+//	Staticcheck  run staticcheck, which must be in $PATH
+//	Race         build and run the program with the race detector
+//	Cover        run the tests and report the coverage of each function
+//	Bench        run the benchmarks
+//
+// If the window has unsaved changes, it is written first.
+//
+// The last 100 runs are kept in the playground's history, in numbered
+// directories under .goplay/history: the source files run, the
+// standard input, the output shown, and the mode, start time, duration
+// and exit code. The tags also get a History command listing the runs
+// in the +history window, and the commands, typed in the tag and
+// executed with their arguments,
+//
+//	Diff [-o] run1 run2
+//	Restore run
+//
+// Diff shows in the +diff window the differences between the sources
+// of two runs, given by their numbers, or between their outputs with
+// -o. Restore replaces the window's contents with its file as it was
+// in the given run; Put runs it again.
+//
+// The -s flag opens the named session instead, creating it if it
+// does not exist. A session is a playground kept in
+// $XDG_DATA_HOME/goplay/name (~/.local/share/goplay/name by default),
+// so its files and go.mod survive the window being deleted and can
+// be resumed later. The -l flag lists the sessions, and the -rm flag
+// deletes one.
+//
+// By default, playgrounds are built with the go command found in
+// $PATH. The -go flag selects a Go release instead, such as 1.22.3:
+// the go directive of go.mod is set to it, and GOTOOLCHAIN makes the
+// go command download and run that release if need be. A release
+// given without its patch number, such as 1.22, is its first one,
+// 1.22.0; releases before 1.21 cannot be downloaded. The -gobin flag
+// names a go command to use instead, such as ~/sdk/go1.20.14/bin/go.
+// The -compare flag gives several toolchains, as releases or go
+// commands, separated by commas: each run builds and runs the program
+// with each toolchain, in its own directory, and shows the outputs in
+// columns side by side, best viewed in a fixed-width font. The go
+// directive is set to the language version of the oldest toolchain.
+// Only one of -go, -gobin and -compare may be given.
+//
+// The -http flag makes goplay a playground server instead, listening
+// on the given address, such as :8080. It serves the /compile, /fmt
+// and /share endpoints of play.golang.org, with the same JSON
+// replies, so editor plugins and bots made for the official
+// playground can use it. Each program is built and run in a new
+// temporary playground, for 10 seconds at most unless -timeout says
+// otherwise, in the sandbox with -sandbox, and with the first
+// toolchain given by -go, -gobin or -compare. At most 4 programs run
+// at once. Shared snippets are stored in the .shares subdirectory of
+// the sessions directory, and served as /p/ID.go.
+//
+// Anyone who can reach the server can run programs as the user
+// running goplay, so addresses reachable from other hosts, such as
+// :8080 or 192.168.1.2:8080, need -sandbox; localhost:8080 does not.
+// Programs writing more than 1MB of output are killed. Web pages may
+// only call the server from the origin given by -cors, such as
+// https://example.com, or from any origin if it is *.
+//
+// The -w flag is for other editors: instead of using acme, goplay
+// prints the path of the playground, watches it with inotify (Linux
+// only), and runs it each time one of its files is written, showing
+// the output on the terminal, cleared before each run. Hidden files,
+// editor backups, go.mod and go.sum, which goplay itself changes, and
+// files unpacked from a.go are not watched, files are not formatted,
+// and the standard input of the programs is the file .goplay/stdin.
+// Interrupting goplay ends the watch.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 
 	"9fans.net/go/acme"
 )
 
+var (
+	sessionFlag  = flag.String("s", "", "open or create the session `name`")
+	listFlag     = flag.Bool("l", false, "list sessions")
+	rmFlag       = flag.String("rm", "", "delete the session `name`")
+	fmtFlag      = flag.Bool("fmt", true, "format files and fix their imports on put")
+	goFlag       = flag.String("go", "", "build with Go `version`, setting the go directive and GOTOOLCHAIN")
+	gobinFlag    = flag.String("gobin", "", "build with the go command `file`")
+	compareFlag  = flag.String("compare", "", "run with each of the comma-separated `toolchains` side by side")
+	httpFlag     = flag.String("http", "", "serve the playground API on `address` instead of using acme")
+	corsFlag     = flag.String("cors", "", "let web pages from `origin` use the -http server (* for any)")
+	templateFlag = flag.String("t", "", "start from the template `name` (default hello)")
+	faketimeFlag = flag.Bool("faketime", false, "build with the faketime tag and replay the output with its delays")
+	sandboxFlag  = flag.Bool("sandbox", false, "run programs in a sandbox (Linux only)")
+	watchFlag    = flag.Bool("w", false, "watch the playground for writes and show the output on the terminal instead of using acme")
+	timeout      = flag.Duration("timeout", 0, "kill programs running longer than `duration` (default no limit, or 1m with -faketime)")
+)
+
 var HelloProg = `package main
 
 import "fmt"
@@ -34,45 +230,186 @@ func main() {
 }
 `
 
-func run(filename string) {
-	cmd := exec.Command("go", "run", filename)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Printf("%s\n", err)
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: goplay [-faketime] [-fmt=false] [-sandbox] [-s name] [-t template]\n")
+	fmt.Fprintf(os.Stderr, "\t[-timeout duration] [-go version | -gobin file | -compare toolchain,...]\n")
+	fmt.Fprintf(os.Stderr, "       goplay -l\n")
+	fmt.Fprintf(os.Stderr, "       goplay -rm name\n")
+	fmt.Fprintf(os.Stderr, "       goplay [-cors origin] [-faketime] [-sandbox] [-timeout duration]\n")
+	fmt.Fprintf(os.Stderr, "\t-http address\n")
+	fmt.Fprintf(os.Stderr, "       goplay -w [-faketime] [-sandbox] [-s name] [-t template]\n")
+	fmt.Fprintf(os.Stderr, "\t[-timeout duration] [-go version | -gobin file | -compare toolchain,...]\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "Missing modules are added from the module cache, with GOSUMDB=off.\n")
+	os.Exit(2)
+}
+
+// setup creates the playground files in dir from the template,
+// unless they already exist.
+func setup(dir string, t *template) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	file := path.Join(dir, "a.go")
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err := t.create(dir); err != nil {
+			return err
+		}
+	} else if *templateFlag != "" {
+		log.Printf("%s already exists; ignoring template", dir)
+	}
+	if _, err := os.Stat(path.Join(dir, "go.mod")); os.IsNotExist(err) {
+		modInit(dir)
+	}
+	return nil
+}
+
+// modInit creates the go.mod file of the playground dir.
+func modInit(dir string) {
+	modInitCmd := exec.Command("go", "mod", "init", "foo.bar/goplay")
+	modInitCmd.Dir = dir
+	if err := modInitCmd.Run(); err != nil {
+		log.Printf("error doing mod init in %s: %v", dir, err)
 	}
 }
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("goplay: ")
+	if len(os.Args) > 1 && os.Args[1] == sandboxArg {
+		log.Fatal(sandboxExec(os.Args[2:]))
+	}
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
 
-	dir, err := ioutil.TempDir("", "goplay")
+	var specs []string
+	for _, f := range []string{*goFlag, *gobinFlag, *compareFlag} {
+		if f != "" {
+			if specs != nil {
+				log.Fatal("only one of -go, -gobin and -compare may be given")
+			}
+			specs = strings.Split(f, ",")
+		}
+	}
+	for _, spec := range specs {
+		tc, err := parseToolchain(strings.TrimSpace(spec))
+		if err != nil {
+			log.Fatal(err)
+		}
+		toolchains = append(toolchains, tc)
+	}
+
+	switch {
+	case *httpFlag != "":
+		log.Fatal(serve(*httpFlag))
+	case *listFlag:
+		names, err := listSessions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	case *rmFlag != "":
+		if err := removeSession(*rmFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	name := *templateFlag
+	if name == "" {
+		name = "hello"
+	}
+	tmpl, err := findTemplate(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var dir string
+	if *sessionFlag != "" {
+		dir, err = sessionDir(*sessionFlag)
+	} else {
+		dir, err = ioutil.TempDir("", "goplay")
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := setup(dir, tmpl); err != nil {
+		log.Fatal(err)
+	}
+	if len(toolchains) > 0 {
+		if err := setGoVersion(dir, toolchains); err != nil {
+			log.Fatal(err)
+		}
+	}
 	if err := os.Chdir(dir); err != nil {
 		log.Fatal(err)
 	}
 
-	defer os.RemoveAll(dir)
-	file := path.Join(dir, "a.go")
-	if err := ioutil.WriteFile(file, []byte(HelloProg), 0600); err != nil {
-		log.Fatal(err)
+	if *sessionFlag == "" {
+		defer os.RemoveAll(dir)
 	}
-	modInitCmd := exec.Command("go", "mod", "init", "foo.bar/goplay")
-	if err := modInitCmd.Run(); err != nil {
-		log.Printf("error doing mod init in %s: %v", dir, err)
+	file := path.Join(dir, "a.go")
+
+	if *watchFlag {
+		fmt.Println(dir)
+		out := newOutput(dir, &termScreen{w: os.Stdout, title: dir})
+		runs := newRunner(dir, readMode(dir), newInput(dir), out)
+		defer runs.stop()
+		if err := watch(dir, runs); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
+	outwin := newOutput(dir, &winScreen{dir: dir})
+	defer outwin.close()
+	in := newInput(dir)
+	if err := in.open(); err != nil {
+		log.Fatal(err)
+	}
+	defer in.close()
+	runs := newRunner(dir, readMode(dir), in, outwin)
+	defer runs.stop()
 	r, err := acme.Log()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	out, err := exec.Command("plumb", "-d", "edit", file).CombinedOutput()
-	if err != nil {
-		log.Fatalf("executing plumb: %v\n%s", err, out)
+	// Windows of Go files of the playground get the mode commands in
+	// their tag: those already open, say for a resumed session, and
+	// those opened from now on.
+	attached := make(map[int]bool)
+	tag := func(id int, name string) {
+		if !attached[id] && strings.HasPrefix(name, dir+"/") && strings.HasSuffix(name, ".go") {
+			attached[id] = true
+			go attach(id, name, runs)
+		}
+	}
+	if ws, err := acme.Windows(); err == nil {
+		for _, w := range ws {
+			tag(w.ID, w.Name)
+		}
+	}
+
+	files := []string{file}
+	if test := path.Join(dir, "a_test.go"); exists(test) {
+		files = append(files, test)
+	}
+	for _, f := range files {
+		out, err := exec.Command("plumb", "-d", "edit", f).CombinedOutput()
+		if err != nil {
+			log.Fatalf("executing plumb: %v\n%s", err, out)
+		}
 	}
 
 	for {
@@ -83,8 +420,14 @@ func main() {
 		if ev.Op == "del" && ev.Name == file {
 			break
 		}
-		if ev.Op == "put" && ev.Name == file {
-			run(file)
+		switch ev.Op {
+		case "new", "put":
+			tag(ev.ID, ev.Name)
+		case "del":
+			delete(attached, ev.ID)
+		}
+		if ev.Op == "put" && strings.HasPrefix(ev.Name, dir+"/") {
+			runs.start(ev.ID, ev.Name, "")
 		}
 	}
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/semver"
+)
+
+// offline returns the download directory of the module cache of tc,
+// and the environment in which tc's go command uses only that cache.
+// GOPROXY=off would make the go command refuse to use modules it has
+// not been told the version of, so the cache serves as the module
+// proxy instead, with GOSUMDB=off: the checksum database is not
+// consulted, which it could not be offline, and the go.sum lines of
+// the modules added are taken from the cache. The modules in the
+// cache were checked against the database when they were downloaded.
+func offline(tc *toolchain) (cache string, env []string, err error) {
+	out, err := tc.command("env", "GOMODCACHE").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s env: %v", tc.name, err)
+	}
+	cache = filepath.Join(strings.TrimSpace(string(out)), "cache", "download")
+	env = []string{
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=file://" + filepath.ToSlash(cache),
+		"GOSUMDB=off",
+	}
+	return cache, env, nil
+}
+
+// MissingRef matches the error of the go command for an imported
+// package that no module in go.mod provides, such as
+//
+//	a.go:6:2: cannot find module providing package example.com/m/pkg: import lookup disabled by -mod=readonly
+var MissingRef = regexp.MustCompile(`(?:no required module provides|cannot find module providing) package ([^\s:;]+)`)
+
+// resolve adds to the go.mod file of the unpacked playground dir the
+// modules providing the packages it imports that are missing from it,
+// taking the latest version found in the module cache, using the
+// toolchain tc. It reports the modules added, and the packages not in
+// the cache, to w.
+func resolve(ctx context.Context, dir string, u *unpacked, tc *toolchain, w io.Writer) error {
+	cache, env, err := offline(tc)
+	if err != nil {
+		return err
+	}
+	out, err := listErrors(ctx, dir, u, tc)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return nil // let the build report it
+	}
+
+	var unavailable []string
+	added := make(map[string]bool)
+	for _, m := range MissingRef.FindAllStringSubmatch(out, -1) {
+		pkg := m[1]
+		mod, version := cachedModule(cache, pkg)
+		if mod == "" {
+			unavailable = append(unavailable, pkg)
+			continue
+		}
+		if added[mod] {
+			continue
+		}
+		added[mod] = true
+		var errs bytes.Buffer
+		cmd := tc.command("get", mod+"@"+version)
+		cmd.Env = append(cmd.Environ(), env...)
+		cmd.Dir = dir
+		cmd.Stderr = &errs
+		if err := runCmd(ctx, cmd); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(w, "%s", &errs)
+			unavailable = append(unavailable, pkg)
+			continue
+		}
+		fmt.Fprintf(w, "go: added %s %s\n", mod, version)
+	}
+	if len(unavailable) > 0 {
+		fmt.Fprintf(w, "not in the module cache, so unavailable offline: %s\n", strings.Join(unavailable, ", "))
+	}
+	return nil
+}
+
+// depsFile holds the output of the go list run by listErrors in the
+// playground, after the key it was run for on its own line.
+const depsFile = ".goplay/deps"
+
+// listErrors returns the errors of the packages the unpacked playground
+// dir depends on, as go list reports them using the toolchain tc. Since
+// go list takes a while, its output is kept in depsFile, and reused as
+// long as the key returned by depsKey stays the same.
+func listErrors(ctx context.Context, dir string, u *unpacked, tc *toolchain) (string, error) {
+	key := depsKey(dir, tc)
+	record := filepath.Join(dir, depsFile)
+	if key != "" {
+		if data, err := ioutil.ReadFile(record); err == nil && strings.HasPrefix(string(data), key+"\n") {
+			return string(data[len(key)+1:]), nil
+		}
+	}
+
+	args := []string{"list", "-e", "-deps", "-f", "{{with .Error}}{{.}}{{end}}"}
+	if u.overlay != "" {
+		args = append(args, "-overlay", u.overlay)
+	}
+	var out bytes.Buffer
+	cmd := tc.command(append(args, ".")...)
+	cmd.Env = append(cmd.Environ(), "GOFLAGS=-mod=readonly")
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	if err := runCmd(ctx, cmd); err != nil {
+		return "", err
+	}
+	if key != "" {
+		ioutil.WriteFile(record, []byte(key+"\n"+out.String()), 0600)
+	}
+	return out.String(), nil
+}
+
+// depsKey returns a hash of what the output of go list in listErrors
+// depends on: the toolchain tc, the go.mod and go.sum files of the
+// playground dir, and the imports of its Go files, including the ones
+// of a.go before its archive. It returns "" if any of them cannot be
+// read.
+func depsKey(dir string, tc *toolchain) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", tc.name)
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return ""
+		}
+		fmt.Fprintf(h, "%s %d\n%s", name, len(data), data)
+	}
+	fset := token.NewFileSet()
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if name != dir && (strings.HasPrefix(fi.Name(), ".") || fi.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		// Parsing stops after the imports, so the archive of a.go,
+		// which follows its code, is not looked at.
+		f, err := parser.ParseFile(fset, name, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		var paths []string
+		for _, imp := range f.Imports {
+			paths = append(paths, imp.Path.Value)
+		}
+		sort.Strings(paths)
+		rel, _ := filepath.Rel(dir, name)
+		fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), strings.Join(paths, " "))
+		return nil
+	})
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// cachedModule returns the module that may provide the package pkg,
+// and its latest version, among the modules downloaded in the cache.
+// Longer module paths are preferred, and so are releases over
+// pre-release versions and pseudo-versions, as go get prefers them.
+func cachedModule(cache, pkg string) (mod, version string) {
+	for mod := pkg; mod != "." && mod != "/"; mod = filepath.Dir(mod) {
+		infos, err := ioutil.ReadDir(filepath.Join(cache, escapePath(mod), "@v"))
+		if err != nil {
+			continue
+		}
+		release := ""
+		for _, fi := range infos {
+			v := strings.TrimSuffix(fi.Name(), ".zip")
+			if v == fi.Name() || !semver.IsValid(v) {
+				continue
+			}
+			if version == "" || semver.Compare(v, version) > 0 {
+				version = v
+			}
+			if semver.Prerelease(v) == "" && (release == "" || semver.Compare(v, release) > 0) {
+				release = v
+			}
+		}
+		if release != "" {
+			version = release
+		}
+		if version != "" {
+			return filepath.ToSlash(mod), version
+		}
+	}
+	return "", ""
+}
+
+// escapePath escapes a module path the way the module cache does:
+// upper-case letters become ! followed by the lower-case letter.
+func escapePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var cachedModuleTests = []struct {
+	pkg          string
+	mod, version string
+}{
+	{"example.com/rel/pkg", "example.com/rel", "v1.2.0"},
+	{"example.com/pre", "example.com/pre", "v0.2.0-rc.1"},
+	{"example.com/pseudo", "example.com/pseudo", "v0.0.0-20240102030405-abcdefabcdef"},
+	{"example.com/Upper/x", "example.com/Upper", "v1.0.0"},
+	{"example.com/rel/sub/pkg", "example.com/rel/sub", "v0.1.0"},
+	{"example.com/none", "", ""},
+}
+
+func TestCachedModule(t *testing.T) {
+	cache, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	for mod, files := range map[string][]string{
+		"example.com/rel":     {"v1.0.0.zip", "v1.2.0.zip", "v1.3.0-beta.1.zip", "v1.4.0.mod", "v1.5.0-0.20240102030405-abcdefabcdef.zip", "list"},
+		"example.com/rel/sub": {"v0.1.0.zip"},
+		"example.com/pre":     {"v0.1.0-rc.1.zip", "v0.2.0-rc.1.zip"},
+		"example.com/pseudo":  {"v0.0.0-20240102030405-abcdefabcdef.zip"},
+		"example.com/!upper":  {"v1.0.0.zip"},
+		"example.com/none":    {"v1.0.0.info"},
+	} {
+		dir := filepath.Join(cache, filepath.FromSlash(mod), "@v")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, tt := range cachedModuleTests {
+		mod, version := cachedModule(cache, tt.pkg)
+		if mod != tt.mod || version != tt.version {
+			t.Errorf("cachedModule(%q) = %q, %q; expected %q, %q", tt.pkg, mod, version, tt.mod, tt.version)
+		}
+	}
+}
+
+func TestDepsKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tc := &toolchain{name: "go", gobin: "go"}
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("go.mod", "module play\n")
+	write("a.go", "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(1) }\n-- b.go --\npackage main\n")
+	key := depsKey(dir, tc)
+	if key == "" {
+		t.Fatal("no key")
+	}
+	for _, tt := range []struct {
+		name, data string
+		same       bool
+	}{
+		{"a.go", "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(2) }\n", true},
+		{"a.go", "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() { fmt.Println(os.Args) }\n", false},
+		{"c.go", "package main\n\nimport \"example.com/m\"\n", false},
+		{"go.sum", "example.com/m v1.0.0 h1:x\n", false},
+		{"go.mod", "module play\n\nrequire example.com/m v1.0.0\n", false},
+	} {
+		write(tt.name, tt.data)
+		next := depsKey(dir, tc)
+		if next == "" || (next == key) != tt.same {
+			t.Errorf("after writing %s %q: key changed %v; expected %v", tt.name, tt.data, next != key, !tt.same)
+		}
+		key = next
+	}
+	write("d.go", "package main\nimport (")
+	if key := depsKey(dir, tc); key != "" {
+		t.Errorf("key %q with a file that does not parse; expected none", key)
+	}
+}
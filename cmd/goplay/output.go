@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// An output shows the output of the programs run in a playground, on
+// a screen: the +goplay window, or the terminal.
+type output struct {
+	dir string // playground directory
+	scr screen
+
+	mu    sync.Mutex
+	buf   []byte         // partial line not yet written
+	body  []byte         // text written since the last reset
+	lines map[string]int // line in a.go of the files unpacked from it
+}
+
+// A screen is where an output is shown.
+type screen interface {
+	// clear clears the screen, creating it if need be.
+	clear() error
+
+	// write writes p at the end of the screen.
+	write(p []byte)
+
+	// close removes the screen.
+	close()
+}
+
+func newOutput(dir string, scr screen) *output {
+	return &output{dir: dir, scr: scr}
+}
+
+// reset clears the screen.
+func (o *output) reset() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = nil
+	o.body = nil
+	return o.scr.clear()
+}
+
+// close removes the screen.
+func (o *output) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.scr.close()
+}
+
+// setUnpacked sets the lines of a.go at which the files unpacked from
+// it start, so that addresses in those files point into a.go.
+func (o *output) setUnpacked(lines map[string]int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = lines
+}
+
+// Write writes p to the screen, with the relative file names in
+// compiler errors made absolute. Partial lines are held back until
+// they are complete or Flush is called.
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf = append(o.buf, p...)
+	i := bytes.LastIndexByte(o.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	o.write(o.buf[:i+1])
+	o.buf = append([]byte(nil), o.buf[i+1:]...)
+	return len(p), nil
+}
+
+// Flush writes any partial line held back.
+func (o *output) Flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.write(o.buf)
+	o.buf = nil
+}
+
+func (o *output) write(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	p = absAddrs(p, o.dir, o.lines)
+	o.body = append(o.body, p...)
+	o.scr.write(p)
+}
+
+// text returns the text written since the last reset.
+func (o *output) text() []byte {
+	o.Flush()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]byte(nil), o.body...)
+}
+
+// addrs returns p with its addresses made absolute, as Write does.
+func (o *output) addrs(p []byte) []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return absAddrs(p, o.dir, o.lines)
+}
+
+// Printf formats its arguments and writes them to the screen,
+// after any pending output.
+func (o *output) Printf(format string, args ...interface{}) {
+	o.Flush()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p := []byte(fmt.Sprintf(format, args...))
+	o.body = append(o.body, p...)
+	o.scr.write(p)
+}
+
+// A winScreen is the +goplay window of a playground.
+type winScreen struct {
+	dir string // playground directory
+	win *acme.Win
+}
+
+// clear opens the window, creating it if it was never created or has
+// been deleted, and clears it.
+func (s *winScreen) clear() error {
+	if s.win != nil {
+		if err := s.win.Ctl("clean"); err == nil {
+			s.win.Clear()
+			return nil
+		}
+		s.win.CloseFiles()
+		s.win = nil
+	}
+	win, err := acme.New()
+	if err != nil {
+		return err
+	}
+	win.Name("%s", filepath.Join(s.dir, "+goplay"))
+	s.win = win
+	return nil
+}
+
+func (s *winScreen) write(p []byte) {
+	if s.win != nil {
+		s.win.Write("body", p)
+		s.win.Ctl("clean")
+	}
+}
+
+// close deletes the window.
+func (s *winScreen) close() {
+	if s.win != nil {
+		s.win.Ctl("delete")
+		s.win.CloseFiles()
+		s.win = nil
+	}
+}
+
+// A termScreen is a terminal.
+type termScreen struct {
+	w     io.Writer
+	title string // shown at the top
+}
+
+// clear clears the terminal, with the ANSI escape sequences moving the
+// cursor home and erasing the display, and shows the title.
+func (s *termScreen) clear() error {
+	_, err := fmt.Fprintf(s.w, "\x1b[H\x1b[2J%s\n\n", s.title)
+	return err
+}
+
+func (s *termScreen) write(p []byte) {
+	s.w.Write(p)
+}
+
+func (s *termScreen) close() {}
+
+// FileRef matches a relative Go file address at the start of a line,
+// after any indentation, such as ./a.go:5:2 or the address of a test
+// failure printed by go test -v.
+var FileRef = regexp.MustCompile(`(?m)^([ \t]*)(?:\./)?([^\s/:][^\s:]*\.go):([0-9]+)((?::[0-9]+)?)`)
+
+// absAddrs rewrites the file addresses in p relative to dir into
+// absolute ones, which plumb back to the playground's windows. The
+// addresses in files unpacked from a.go, which start at the given
+// lines of a.go, are made to point into a.go.
+func absAddrs(p []byte, dir string, lines map[string]int) []byte {
+	return FileRef.ReplaceAllFunc(p, func(m []byte) []byte {
+		sm := FileRef.FindSubmatch(m)
+		indent, name, line, col := string(sm[1]), string(sm[2]), string(sm[3]), string(sm[4])
+		if start, ok := lines[name]; ok {
+			n, _ := strconv.Atoi(line)
+			name, line = "a.go", strconv.Itoa(start+n)
+		}
+		return []byte(indent + filepath.Join(dir, name) + ":" + line + col)
+	})
+}
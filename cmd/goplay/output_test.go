@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+var absAddrsTests = []struct {
+	in, out string
+}{
+	{"./a.go:5:2: undefined: x\n", "/p/a.go:5:2: undefined: x\n"},
+	{"a.go:5: missing return\n", "/p/a.go:5: missing return\n"},
+	{"    a_test.go:51: Reverse(\"ab\") = \"ab\"\n", "    /p/a_test.go:51: Reverse(\"ab\") = \"ab\"\n"},
+	{"\tsub/b.go:3:1: syntax error\n", "\t/p/sub/b.go:3:1: syntax error\n"},
+	{"b.go:2:6: x declared and not used\n", "/p/a.go:12:6: x declared and not used\n"},
+	{"/usr/lib/go/src/fmt/print.go:10: x\n", "/usr/lib/go/src/fmt/print.go:10: x\n"},
+	{"ok a.go:5 in text\n", "ok a.go:5 in text\n"},
+}
+
+func TestAbsAddrs(t *testing.T) {
+	lines := map[string]int{"b.go": 10}
+	for _, tt := range absAddrsTests {
+		if out := string(absAddrs([]byte(tt.in), "/p", lines)); out != tt.out {
+			t.Errorf("absAddrs(%q) = %q; expected %q", tt.in, out, tt.out)
+		}
+	}
+}
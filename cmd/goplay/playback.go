@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Programs built with the faketime tag, like those of play.golang.org,
+// start at playbackEpoch, and precede each write to standard output or
+// error with a playback header: playbackMagic, the fake time in
+// nanoseconds since 1970 as 8 bytes and the length of the data as 4
+// bytes, both big endian.
+var (
+	playbackEpoch = time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	playbackMagic = []byte("\x00\x00PB")
+)
+
+const playbackHeaderSize = 4 + 8 + 4
+
+// maxPlayback is the most output kept from a program built with the
+// faketime tag, or run by the server, and the program is killed once
+// it has written that much. Output is held in memory until the
+// program ends, and since sleeping takes no time with faketime, a
+// program printing in a loop writes a lot quickly.
+const maxPlayback = 1 << 20
+
+// A playbackEvent is a write by a program built with the faketime tag.
+type playbackEvent struct {
+	time time.Time
+	kind string // stdout or stderr
+	data []byte
+}
+
+// A playback decodes the output of a program built with the faketime
+// tag into timestamped events.
+type playback struct {
+	full func() // if set, called once maxPlayback is reached
+
+	mu        sync.Mutex
+	events    []playbackEvent
+	size      int
+	truncated bool
+	last      time.Time         // time of the last event
+	partial   map[string][]byte // data not decoded yet, by kind
+}
+
+// writer returns a writer decoding the output of the given kind, stdout
+// or stderr, into events of p.
+func (p *playback) writer(kind string) io.Writer {
+	return playbackWriter{p, kind}
+}
+
+type playbackWriter struct {
+	p    *playback
+	kind string
+}
+
+func (w playbackWriter) Write(b []byte) (int, error) {
+	p := w.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.partial == nil {
+		p.partial = make(map[string][]byte)
+		p.last = playbackEpoch
+	}
+	buf := append(p.partial[w.kind], b...)
+	for len(buf) > 0 {
+		if bytes.HasPrefix(buf, playbackMagic) {
+			if len(buf) < playbackHeaderSize {
+				break
+			}
+			t := time.Unix(0, int64(binary.BigEndian.Uint64(buf[4:12]))).UTC()
+			n := int(binary.BigEndian.Uint32(buf[12:16]))
+			if len(buf) < playbackHeaderSize+n {
+				break
+			}
+			p.add(t, w.kind, buf[playbackHeaderSize:playbackHeaderSize+n])
+			buf = buf[playbackHeaderSize+n:]
+			continue
+		}
+		// Data without a header, such as the output of a child
+		// process, goes up to the next header, at the time of the
+		// last event. The end of buf may be the start of a header.
+		i := bytes.Index(buf, playbackMagic)
+		if i < 0 {
+			i = len(buf) - magicPrefix(buf)
+			if i == 0 {
+				break
+			}
+		}
+		p.add(p.last, w.kind, buf[:i])
+		buf = buf[i:]
+	}
+	p.partial[w.kind] = append([]byte(nil), buf...)
+	return len(b), nil
+}
+
+// magicPrefix returns the length of the longest end of b that starts
+// playbackMagic.
+func magicPrefix(b []byte) int {
+	for n := len(playbackMagic) - 1; n > 0; n-- {
+		if bytes.HasSuffix(b, playbackMagic[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func (p *playback) add(t time.Time, kind string, data []byte) {
+	if p.size+len(data) > maxPlayback {
+		if !p.truncated && p.full != nil {
+			p.full()
+		}
+		p.truncated = true
+		return
+	}
+	p.size += len(data)
+	if t.After(p.last) {
+		p.last = t
+	}
+	p.events = append(p.events, playbackEvent{t, kind, append([]byte(nil), data...)})
+}
+
+// sorted returns the events in the order they happened, including
+// any data left undecoded. Standard output and error are decoded
+// separately, but their writes have distinct times.
+func (p *playback) sorted() []playbackEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for kind, buf := range p.partial {
+		if len(buf) > 0 {
+			p.add(p.last, kind, buf)
+		}
+		delete(p.partial, kind)
+	}
+	events := append([]playbackEvent(nil), p.events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+	return events
+}
+
+// replay writes the output to w, waiting between the writes for as
+// long as the program did in fake time if delay is true.
+func (p *playback) replay(ctx context.Context, w io.Writer, delay bool) error {
+	last := playbackEpoch
+	for _, e := range p.sorted() {
+		if delay && e.time.After(last) {
+			t := time.NewTimer(e.time.Sub(last))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		if e.time.After(last) {
+			last = e.time
+		}
+		w.Write(e.data)
+	}
+	if p.truncated {
+		io.WriteString(w, "\n[output truncated]\n")
+	}
+	return nil
+}
+
+// serverEvents returns the output as the events of a /compile reply,
+// each with the delay since the previous one. Consecutive writes of
+// the same kind at the same time are merged.
+func (p *playback) serverEvents() []event {
+	var events []event
+	last := playbackEpoch
+	for _, e := range p.sorted() {
+		var d time.Duration
+		if e.time.After(last) {
+			d = e.time.Sub(last)
+			last = e.time
+		}
+		if n := len(events); n > 0 && d == 0 && events[n-1].Kind == e.kind {
+			events[n-1].Message += string(e.data)
+			continue
+		}
+		events = append(events, event{Message: string(e.data), Kind: e.kind, Delay: d})
+	}
+	return events
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame returns data preceded by a playback header for the time d
+// after playbackEpoch.
+func frame(d time.Duration, data string) string {
+	h := make([]byte, playbackHeaderSize)
+	copy(h, playbackMagic)
+	binary.BigEndian.PutUint64(h[4:], uint64(playbackEpoch.Add(d).UnixNano()))
+	binary.BigEndian.PutUint32(h[12:], uint32(len(data)))
+	return string(h) + data
+}
+
+type playbackWrite struct {
+	kind, data string
+}
+
+// splitWrites returns the writes of data of the given kind, one byte
+// at a time.
+func splitWrites(kind, data string) []playbackWrite {
+	var writes []playbackWrite
+	for i := 0; i < len(data); i++ {
+		writes = append(writes, playbackWrite{kind, data[i : i+1]})
+	}
+	return writes
+}
+
+var playbackTests = []struct {
+	name   string
+	writes []playbackWrite
+	events []event
+}{
+	{
+		"frames",
+		[]playbackWrite{
+			{"stdout", frame(0, "a\n") + frame(time.Second, "b\n")},
+			{"stdout", frame(time.Second, "c\n")},
+		},
+		[]event{
+			{"a\n", "stdout", 0},
+			{"b\nc\n", "stdout", time.Second},
+		},
+	},
+	{
+		"header split across writes",
+		append(splitWrites("stdout", frame(2*time.Second, "hello\n")), playbackWrite{"stdout", frame(3*time.Second, "bye\n")}),
+		[]event{
+			{"hello\n", "stdout", 2 * time.Second},
+			{"bye\n", "stdout", time.Second},
+		},
+	},
+	{
+		"partial magic at end of write",
+		[]playbackWrite{
+			{"stdout", "raw\x00"},
+			{"stdout", frame(time.Second, "x\n")[1:]},
+		},
+		[]event{
+			{"raw", "stdout", 0},
+			{"x\n", "stdout", time.Second},
+		},
+	},
+	{
+		"magic prefix that is data",
+		[]playbackWrite{
+			{"stdout", "P\x00\x00"},
+		},
+		[]event{
+			{"P\x00\x00", "stdout", 0},
+		},
+	},
+	{
+		"unframed output of a child process",
+		[]playbackWrite{
+			{"stdout", frame(time.Second, "parent\n") + "child\n" + frame(2*time.Second, "parent again\n")},
+		},
+		[]event{
+			{"parent\nchild\n", "stdout", time.Second},
+			{"parent again\n", "stdout", time.Second},
+		},
+	},
+	{
+		"stdout and stderr in time order",
+		[]playbackWrite{
+			{"stdout", frame(time.Second, "out 1\n") + frame(3*time.Second, "out 3\n")},
+			{"stderr", frame(2*time.Second, "err 2\n") + frame(4*time.Second, "err 4\n")},
+		},
+		[]event{
+			{"out 1\n", "stdout", time.Second},
+			{"err 2\n", "stderr", time.Second},
+			{"out 3\n", "stdout", time.Second},
+			{"err 4\n", "stderr", time.Second},
+		},
+	},
+	{
+		"truncated frame",
+		[]playbackWrite{
+			{"stderr", frame(time.Second, "complete\n") + frame(2*time.Second, "cut short")[:playbackHeaderSize+3]},
+		},
+		[]event{
+			{"complete\n" + frame(2*time.Second, "cut short")[:playbackHeaderSize+3], "stderr", time.Second},
+		},
+	},
+}
+
+func TestPlayback(t *testing.T) {
+	for _, tt := range playbackTests {
+		p := new(playback)
+		for _, w := range tt.writes {
+			p.writer(w.kind).Write([]byte(w.data))
+		}
+		if events := p.serverEvents(); !reflect.DeepEqual(events, tt.events) {
+			t.Errorf("%s: events are %q; expected %q", tt.name, events, tt.events)
+		}
+	}
+}
+
+func TestPlaybackReplay(t *testing.T) {
+	p := new(playback)
+	p.writer("stdout").Write([]byte(frame(time.Hour, "late\n") + frame(0, "early\n")))
+	var buf bytes.Buffer
+	if err := p.replay(context.Background(), &buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "early\nlate\n"; got != want {
+		t.Errorf("replay wrote %q; expected %q", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.replay(ctx, new(bytes.Buffer), true); err != context.Canceled {
+		t.Errorf("replay with delays after cancel returned %v; expected %v", err, context.Canceled)
+	}
+}
+
+func TestPlaybackFull(t *testing.T) {
+	full := 0
+	p := &playback{full: func() { full++ }}
+	w := p.writer("stdout")
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < maxPlayback/len(line)+10; i++ {
+		w.Write([]byte(frame(time.Duration(i)*time.Millisecond, line)))
+	}
+	if full != 1 {
+		t.Errorf("full called %d times; expected 1", full)
+	}
+	var buf bytes.Buffer
+	p.replay(context.Background(), &buf, false)
+	if n := strings.Count(buf.String(), line); n != maxPlayback/len(line) {
+		t.Errorf("replay kept %d lines; expected %d", n, maxPlayback/len(line))
+	}
+	if !strings.HasSuffix(buf.String(), "\n[output truncated]\n") {
+		t.Errorf("replay output does not end with [output truncated]")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build plan9 || windows
+// +build plan9 windows
+
+package main
+
+import "os/exec"
+
+func setpgid(cmd *exec.Cmd) {}
+
+// killGroup kills the started cmd. Its children are left running.
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+// A mode is a way of running a playground.
+type mode struct {
+	test  bool     // build the test binary instead of the program
+	flags []string // build flags
+	args  []string // arguments of the program
+	cover bool     // report the coverage profile written by the program
+	check []string // command checking the package instead, such as go vet
+}
+
+// modes are the known modes, by name.
+var modes = map[string]*mode{
+	"run":         {},
+	"test":        {test: true, args: []string{"-test.v"}},
+	"bench":       {test: true, args: []string{"-test.run=^$", "-test.bench=.", "-test.benchmem"}},
+	"race":        {flags: []string{"-race"}},
+	"cover":       {test: true, flags: []string{"-cover"}, args: []string{"-test.coverprofile=" + coverProfile}, cover: true},
+	"vet":         {check: []string{"go", "vet"}},
+	"staticcheck": {check: []string{"staticcheck"}},
+}
+
+// workDir is the directory, relative to the playground, in which the
+// programs run. It is emptied before each run, and hidden like the
+// rest of .goplay, so that the files programs write do not start
+// another run. When toolchains are compared, each runs in its own
+// subdirectory, named after its index.
+const workDir = ".goplay/run"
+
+// coverProfile is the coverage profile written in cover mode, relative
+// to the directory the program runs in.
+const coverProfile = "cover.out"
+
+// A runner runs the playground program in the background, one run at
+// a time: starting a run kills the one in progress.
+type runner struct {
+	dir  string // playground directory
+	mode string // default mode
+	in   *input
+	out  *output
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // of the run in progress
+	done   chan struct{}      // closed when the run in progress ends
+
+	// nextMu guards next apart from mu, since a run sets it aside
+	// while start may hold mu waiting for that run to end.
+	nextMu sync.Mutex
+	next   string // mode of the next run, if not the default
+}
+
+func newRunner(dir, mode string, in *input, out *output) *runner {
+	return &runner{dir: dir, mode: mode, in: in, out: out}
+}
+
+// start kills the run in progress, if any, and starts a new one for
+// the put of the named file in window id, or the write of the file
+// outside acme if id is 0, in the named mode, or if empty the mode set
+// aside for the next run, or the default. Unless -fmt=false, a file put
+// from acme is formatted first; if that changes it, the window is put
+// again and the run is left to that put.
+func (r *runner) start(id int, name, mode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if next := r.takeNext(); mode == "" {
+		mode = next
+	}
+	if mode == "" {
+		mode = r.mode
+	}
+	killed := r.kill()
+	ctx, cancel := context.WithCancel(context.Background())
+	if t := runTimeout(); t > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), t)
+	}
+	done := make(chan struct{})
+	r.cancel, r.done = cancel, done
+	go func() {
+		defer close(done)
+		defer cancel()
+		if *fmtFlag && id > 0 && strings.HasSuffix(name, ".go") && fixWindow(ctx, id, name, func() { r.setNext(mode) }) {
+			return
+		}
+		if ctx.Err() == context.Canceled {
+			// Killed while formatting, by a newer run.
+			return
+		}
+		run(ctx, r.dir, mode, r.in.read(), r.out, killed)
+	}()
+}
+
+// exec starts a run in the named mode, for a command executed in the
+// window id of the named file. If the window has unsaved changes, it
+// is put first, and the run is left to that put.
+func (r *runner) exec(id int, name, mode string) {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer w.CloseFiles()
+	ctl, err := w.ReadAll("ctl")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	// The fifth field of ctl tells whether the window is dirty.
+	if f := strings.Fields(string(ctl)); len(f) > 4 && f[4] == "1" {
+		r.setNext(mode)
+		w.Ctl("put")
+		return
+	}
+	r.start(id, name, mode)
+}
+
+// setNext sets mode aside for the next run.
+func (r *runner) setNext(mode string) {
+	r.nextMu.Lock()
+	defer r.nextMu.Unlock()
+	r.next = mode
+}
+
+// takeNext returns the mode set aside for the next run, if any, and
+// clears it.
+func (r *runner) takeNext() string {
+	r.nextMu.Lock()
+	defer r.nextMu.Unlock()
+	next := r.next
+	r.next = ""
+	return next
+}
+
+// stop kills the run in progress, if any, and waits for it to end.
+func (r *runner) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kill()
+}
+
+// kill kills the run in progress and waits for it to end. It reports
+// whether there was one. The caller must hold r.mu.
+func (r *runner) kill() bool {
+	if r.cancel == nil {
+		return false
+	}
+	running := true
+	select {
+	case <-r.done:
+		running = false
+	default:
+	}
+	r.cancel()
+	<-r.done
+	r.cancel, r.done = nil, nil
+	return running
+}
+
+// run builds the program in the playground dir and runs it in the
+// given mode, with each of the toolchains, showing the output in out.
+// The commands run in their own process group, which is killed when
+// ctx is done. If killed is set, the previous run was killed to make
+// way for this one.
+func run(ctx context.Context, dir, name string, stdin []byte, out *output, killed bool) {
+	if err := out.reset(); err != nil {
+		log.Print(err)
+		return
+	}
+	if killed {
+		out.Printf("[previous run killed]\n")
+	}
+	if err := os.RemoveAll(filepath.Join(dir, workDir)); err != nil {
+		log.Print(err)
+	}
+	rd, err := snapshot(dir)
+	if err != nil {
+		log.Printf("saving run in history: %v", err)
+	}
+	start := time.Now()
+	if len(toolchains) > 1 {
+		err = compare(ctx, dir, modes[name], stdin, out)
+	} else {
+		err = execute(ctx, dir, modes[name], stdin, out)
+		out.Printf("\n%s\n", status(ctx, err, time.Since(start)))
+	}
+	if rd == "" {
+		return
+	}
+	rec := &record{
+		Mode:     name,
+		Time:     start,
+		Duration: time.Since(start),
+		ExitCode: exitCode(ctx, err),
+		Status:   status(ctx, err, time.Since(start)),
+	}
+	if err := rec.save(rd, stdin, out.text()); err != nil {
+		log.Printf("saving run in history: %v", err)
+	}
+}
+
+// errTooMuchOutput ends a run whose program was killed once it wrote
+// maxPlayback bytes with -faketime.
+var errTooMuchOutput = errors.New("killed: too much output")
+
+// faketimeTimeout is the time limit of runs with -faketime, unless
+// -timeout is set. Since sleeping takes no time, a program sleeping
+// in a loop would otherwise run, and hold up its output, forever.
+const faketimeTimeout = time.Minute
+
+// runTimeout returns the time limit of a run, or 0 if there is none.
+func runTimeout() time.Duration {
+	if *timeout == 0 && *faketimeFlag {
+		return faketimeTimeout
+	}
+	return *timeout
+}
+
+// status describes how a run that took the elapsed time ended.
+func status(ctx context.Context, err error, elapsed time.Duration) string {
+	elapsed = elapsed.Round(time.Millisecond)
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Sprintf("[killed: timed out after %v]", runTimeout())
+	case ctx.Err() != nil:
+		return fmt.Sprintf("[killed after %v]", elapsed)
+	case err == nil:
+		return fmt.Sprintf("[exit status 0, %v]", elapsed)
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return fmt.Sprintf("[%v, %v]", err, elapsed)
+	}
+	return fmt.Sprintf("[%v]", err)
+}
+
+// exitCode returns the exit code of a run that ended with err, or -1
+// if the program was killed or never ran.
+func exitCode(ctx context.Context, err error) int {
+	switch {
+	case ctx.Err() != nil:
+		return -1
+	case err == nil:
+		return 0
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		return e.ExitCode()
+	}
+	return -1
+}
+
+// execute unpacks the playground dir and runs it in mode m, with the
+// standard input stdin, showing the output in out.
+func execute(ctx context.Context, dir string, m *mode, stdin []byte, out *output) error {
+	u, err := unpack(dir)
+	if err != nil {
+		return err
+	}
+	out.setUnpacked(u.lines)
+	tc := toolchainFor()
+	if err := resolve(ctx, dir, u, tc, out); err != nil {
+		return err
+	}
+	return runMode(ctx, dir, workDir, m, u, tc, filepath.Join(dir, ".goplay", "a.out"), stdin, out)
+}
+
+// runMode runs the unpacked playground dir, whose imports have been
+// resolved, in mode m using the toolchain tc: it either checks the
+// package, or builds its program, or its test binary, into prog and
+// runs it in work, relative to dir, with the standard input stdin.
+// The output goes to w.
+func runMode(ctx context.Context, dir, work string, m *mode, u *unpacked, tc *toolchain, prog string, stdin []byte, w io.Writer) error {
+	if m.check != nil {
+		return check(ctx, dir, m, u, tc, w)
+	}
+	if err := build(ctx, dir, m, u, tc, prog, w); err != nil {
+		return err
+	}
+	cmd, err := command(dir, work, prog, m)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	var pb *playback
+	progCtx := ctx
+	if *faketimeFlag {
+		var stop context.CancelFunc
+		progCtx, stop = context.WithCancel(ctx)
+		defer stop()
+		pb = &playback{full: stop}
+		cmd.Stdout = pb.writer("stdout")
+		cmd.Stderr = pb.writer("stderr")
+	}
+	err = runCmd(progCtx, cmd)
+	if progCtx.Err() != nil && ctx.Err() == nil {
+		err = errTooMuchOutput
+	}
+	if pb != nil {
+		// The delays are only worth waiting for on a screen.
+		_, screen := w.(*output)
+		if err := pb.replay(ctx, w, screen); err != nil {
+			return err
+		}
+	}
+	if err != nil || !m.cover {
+		return err
+	}
+	fmt.Fprintf(w, "\n")
+	cover := tc.command("tool", "cover", "-func="+filepath.Join(work, coverProfile))
+	cover.Dir = dir
+	cover.Stdout = w
+	cover.Stderr = w
+	return runCmd(ctx, cover)
+}
+
+// build builds the program of the unpacked playground dir, or its test
+// binary, into prog using the toolchain tc. The go command's output
+// goes to w.
+func build(ctx context.Context, dir string, m *mode, u *unpacked, tc *toolchain, prog string, w io.Writer) error {
+	if err := os.MkdirAll(filepath.Dir(prog), 0700); err != nil {
+		return err
+	}
+	args := []string{"build", "-o", prog}
+	if m.test {
+		args = []string{"test", "-c", "-o", prog}
+	}
+	args = append(args, m.flags...)
+	if *faketimeFlag {
+		args = append(args, "-tags=faketime")
+	}
+	if u.overlay != "" {
+		args = append(args, "-overlay", u.overlay)
+	}
+	cmd := tc.command(append(args, ".")...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return runCmd(ctx, cmd)
+}
+
+// check runs the checker of mode m on the unpacked playground dir.
+// The go subcommands, such as go vet, use the toolchain tc and see the
+// files unpacked from a.go; other checkers, such as staticcheck, are
+// run from $PATH and only see the files as they are. The output goes
+// to w.
+func check(ctx context.Context, dir string, m *mode, u *unpacked, tc *toolchain, w io.Writer) error {
+	var cmd *exec.Cmd
+	if m.check[0] == "go" {
+		args := m.check[1:]
+		if u.overlay != "" {
+			args = append(args, "-overlay", u.overlay)
+		}
+		cmd = tc.command(append(args, ".")...)
+	} else {
+		cmd = exec.Command(m.check[0], append(m.check[1:], ".")...)
+	}
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return runCmd(ctx, cmd)
+}
+
+// command returns the command running the binary prog built from the
+// playground dir, in the sandbox if -sandbox is set. It runs in work,
+// relative to dir, where the playground's testdata directory, if any,
+// is linked to.
+func command(dir, work, prog string, m *mode) (*exec.Cmd, error) {
+	wd := filepath.Join(dir, work)
+	if err := os.MkdirAll(wd, 0700); err != nil {
+		return nil, err
+	}
+	if exists(filepath.Join(dir, "testdata")) {
+		up, err := filepath.Rel(work, ".")
+		if err != nil {
+			return nil, err
+		}
+		os.Symlink(filepath.Join(up, "testdata"), filepath.Join(wd, "testdata"))
+	}
+	cmd := exec.Command(prog, m.args...)
+	if *sandboxFlag {
+		var err error
+		if cmd, err = sandboxCommand(dir, prog, m.args...); err != nil {
+			return nil, err
+		}
+	}
+	cmd.Dir = wd
+	return cmd, nil
+}
+
+// runCmd runs cmd in its own process group, and kills the group when
+// ctx is done.
+func runCmd(ctx context.Context, cmd *exec.Cmd) error {
+	setpgid(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	wait := make(chan error, 1)
+	go func() { wait <- cmd.Wait() }()
+
+	select {
+	case err := <-wait:
+		return err
+	case <-ctx.Done():
+		killGroup(cmd)
+		<-wait
+		return ctx.Err()
+	}
+}
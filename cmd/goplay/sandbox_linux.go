@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"9fans.net/go/plan9/client"
+	"golang.org/x/sys/unix"
+)
+
+// Resource limits of sandboxed programs.
+const (
+	sandboxCPU    = 10        // seconds of CPU time
+	sandboxMemory = 512 << 20 // bytes of data
+	sandboxFiles  = 64        // open files
+	sandboxProcs  = 128       // processes and threads
+)
+
+// sandboxTmpSize is the size of the file systems hiding the
+// directories holding sockets.
+const sandboxTmpSize = "16m"
+
+// sandboxUnsetEnv are the environment variables, naming sockets or
+// displays, removed from the environment of sandboxed programs.
+var sandboxUnsetEnv = []string{
+	"SSH_AUTH_SOCK",
+	"GPG_AGENT_INFO",
+	"DISPLAY",
+	"WAYLAND_DISPLAY",
+	"DBUS_SESSION_BUS_ADDRESS",
+	"XDG_RUNTIME_DIR",
+	"NAMESPACE",
+}
+
+// sandboxArg is the first argument given to goplay when it re-executes
+// itself to set up the sandbox, as in
+//
+//	goplay -sandbox-exec dir prog [arg...]
+const sandboxArg = "-sandbox-exec"
+
+// sandboxCommand returns the command running the program prog with
+// the given arguments in a sandbox, for the playground directory dir.
+// The program runs in the working directory given to the command,
+// which must be in dir, and which is also its TMPDIR and HOME. Goplay
+// runs itself in new user, network, mount and PID namespaces, where
+// sandboxExec makes the file system read-only except for dir, hides
+// the directories holding sockets, sets resource limits and executes
+// prog. The network namespace has no interfaces but the loopback,
+// which is down, and the PID namespace has no process but the
+// program's.
+func sandboxCommand(dir, prog string, args ...string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, append([]string{sandboxArg, dir, prog}, args...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1},
+		},
+	}
+	return cmd, nil
+}
+
+// sandboxExec sets up the sandbox and executes the program, given
+// the arguments following sandboxArg. It only returns on error.
+func sandboxExec(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: goplay %s dir prog [arg...]", sandboxArg)
+	}
+	dir, prog := args[0], args[1]
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Keep our mounts from propagating to the parent name space.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %v", err)
+	}
+	// Bind dir onto itself, so it has a mount of its own that stays
+	// writable.
+	if err := syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("mounting %s: %v", dir, err)
+	}
+
+	// A read-only file system does not keep programs from connecting
+	// to the unix sockets in it, such as those of acme, the plumber,
+	// ssh-agent, X11 or D-Bus, so hide the directories holding them
+	// under empty file systems, then put dir back if it was hidden.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	var hidden []string
+	for _, h := range []string{"/tmp", "/run/user", "/var/run/user", client.Namespace()} {
+		if fi, err := os.Stat(h); err != nil || !fi.IsDir() {
+			continue // missing, or already hidden
+		}
+		err := syscall.Mount("tmpfs", h, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777,size="+sandboxTmpSize)
+		if err != nil {
+			return fmt.Errorf("hiding %s: %v", h, err)
+		}
+		hidden = append(hidden, h)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", d.Fd()), dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("mounting %s: %v", dir, err)
+		}
+	}
+
+	// Show the processes of our PID namespace only. This hides the
+	// file systems mounted under /proc too.
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mounting /proc: %v", err)
+	}
+	hidden = append(hidden, "/proc")
+
+	// Make every other mount read-only, failing if one cannot be.
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if m.readOnly || under(m.dir, dir) || underAny(m.dir, hidden) {
+			continue
+		}
+		err := syscall.Mount("", m.dir, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|m.flags, "")
+		if err != nil {
+			return fmt.Errorf("remounting %s read-only: %v", m.dir, err)
+		}
+	}
+
+	// Our working directory is still on the read-only mount.
+	if err := os.Chdir(wd); err != nil {
+		return err
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, sandboxCPU},
+		{syscall.RLIMIT_DATA, sandboxMemory},
+		{syscall.RLIMIT_NOFILE, sandboxFiles},
+		{unix.RLIMIT_NPROC, sandboxProcs},
+	}
+	for _, l := range limits {
+		r := syscall.Rlimit{Cur: l.value, Max: l.value}
+		if err := syscall.Setrlimit(l.resource, &r); err != nil {
+			return fmt.Errorf("setting resource limit: %v", err)
+		}
+	}
+
+	for _, v := range sandboxUnsetEnv {
+		os.Unsetenv(v)
+	}
+	env := append(os.Environ(), "TMPDIR="+wd, "HOME="+wd)
+	return syscall.Exec(prog, args[1:], env)
+}
+
+// A mount is a mounted file system.
+type mount struct {
+	dir      string
+	readOnly bool
+	flags    uintptr // flags that must be kept when remounting
+}
+
+// under reports whether the file name is dir or inside it.
+func under(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// underAny reports whether the file name is one of dirs or inside one.
+func underAny(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if under(name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMounts returns the file systems mounted in our name space, in
+// mount order, from /proc/self/mountinfo.
+func readMounts() ([]mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []mount
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(s.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		m := mount{dir: unescapeMount(fields[4])}
+		for _, opt := range strings.Split(fields[5], ",") {
+			switch opt {
+			case "ro":
+				m.readOnly = true
+			case "nosuid":
+				m.flags |= syscall.MS_NOSUID
+			case "nodev":
+				m.flags |= syscall.MS_NODEV
+			case "noexec":
+				m.flags |= syscall.MS_NOEXEC
+			case "noatime":
+				m.flags |= syscall.MS_NOATIME
+			case "nodiratime":
+				m.flags |= syscall.MS_NODIRATIME
+			case "relatime":
+				m.flags |= syscall.MS_RELATIME
+			case "strictatime":
+				m.flags |= syscall.MS_STRICTATIME
+			}
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, s.Err()
+}
+
+// unescapeMount undoes the octal escapes of spaces and other special
+// characters in the mount points of /proc/self/mountinfo.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
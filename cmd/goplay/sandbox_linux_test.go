@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+var underTests = []struct {
+	name, dir string
+	ok        bool
+}{
+	{"/tmp", "/tmp", true},
+	{"/tmp/x", "/tmp", true},
+	{"/tmpx", "/tmp", false},
+	{"/home/u/play", "/home/u/play", true},
+	{"/home/u/play/.goplay", "/home/u/play", true},
+	{"/home/u/playground", "/home/u/play", false},
+	{"/proc/sys/fs/binfmt_misc", "/proc", true},
+	{"/", "/proc", false},
+}
+
+func TestUnder(t *testing.T) {
+	for _, tt := range underTests {
+		if ok := under(tt.name, tt.dir); ok != tt.ok {
+			t.Errorf("under(%q, %q) = %v; expected %v", tt.name, tt.dir, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+const sandboxArg = "-sandbox-exec"
+
+func sandboxCommand(dir, prog string, args ...string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("sandbox not supported on %s", runtime.GOOS)
+}
+
+func sandboxExec(args []string) error {
+	return fmt.Errorf("sandbox not supported on %s", runtime.GOOS)
+}
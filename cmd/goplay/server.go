@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of the playground server.
+const (
+	maxSnippetSize = 64 << 10
+	maxRequestSize = 4 * maxSnippetSize // form encoding may triple the snippet
+	serverTimeout  = 10 * time.Second   // unless -timeout is set
+	maxCompiles    = 4                  // programs built and run at once
+)
+
+// compiles holds a token for each /compile request being served.
+var compiles = make(chan struct{}, maxCompiles)
+
+// serve runs the playground server on addr. It speaks the API of
+// play.golang.org, so its clients can use it instead.
+func serve(addr string) error {
+	if err := checkAddr(addr, *sandboxFlag); err != nil {
+		return err
+	}
+	http.HandleFunc("/compile", handleCompile)
+	http.HandleFunc("/fmt", handleFmt)
+	http.HandleFunc("/share", handleShare)
+	http.HandleFunc("/p/", handleSnippet)
+	log.Printf("serving on %s", addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+// checkAddr checks the -http address addr. The server runs any
+// program it is sent, so addresses other hosts can reach, including
+// those without a host, such as :8080, are refused unless the
+// programs run in a sandbox.
+func checkAddr(addr string, sandbox bool) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); !sandbox && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("serving on %s lets other hosts run programs; use -sandbox, or localhost:%s", addr, port)
+	}
+	return nil
+}
+
+// An event is a write to standard output or error by the program.
+type event struct {
+	Message string
+	Kind    string        // "stdout" or "stderr"
+	Delay   time.Duration // time to wait before printing Message
+}
+
+type compileResponse struct {
+	Errors      string
+	Events      []event
+	Status      int
+	IsTest      bool
+	TestsFailed int
+	VetErrors   string `json:",omitempty"`
+	VetOK       bool   `json:",omitempty"`
+}
+
+type fmtResponse struct {
+	Body  string
+	Error string
+}
+
+// allowCORS lets the origin given by -cors, if any, read the reply,
+// and reports whether r is a preflight request, needing no more reply.
+func allowCORS(w http.ResponseWriter, r *http.Request) bool {
+	if *corsFlag == "" {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", *corsFlag)
+	return r.Method == "OPTIONS"
+}
+
+// formBody returns the form value body of r. If the request or the
+// body is too large, or the form is malformed, it replies with an
+// error and returns false.
+func formBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if err := r.ParseForm(); err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return "", false
+	}
+	body := r.FormValue("body")
+	if len(body) > maxSnippetSize {
+		http.Error(w, "snippet too large", http.StatusRequestEntityTooLarge)
+		return "", false
+	}
+	return body, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
+
+// handleCompile builds and runs the program in the form value body,
+// which may be in the txtar format, in a new playground. If withVet
+// is true, the program is vetted too. At most maxCompiles programs
+// run at once; other requests are turned away.
+func handleCompile(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	select {
+	case compiles <- struct{}{}:
+		defer func() { <-compiles }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many programs running", http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := formBody(w, r)
+	if !ok {
+		return
+	}
+	resp, err := compile(r.Context(), []byte(body), r.FormValue("withVet") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// compile builds and runs src in a temporary playground.
+func compile(ctx context.Context, src []byte, vet bool) (*compileResponse, error) {
+	t := serverTimeout
+	if *timeout > 0 {
+		t = *timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, t)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), src, 0600); err != nil {
+		return nil, err
+	}
+	modInit(dir)
+	if len(toolchains) > 0 {
+		if err := setGoVersion(dir, toolchains[:1]); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := new(compileResponse)
+	u, err := unpack(dir)
+	if err != nil {
+		resp.Errors = err.Error()
+		return resp, nil
+	}
+	var buf bytes.Buffer
+	tc := toolchainFor()
+	if err := resolve(ctx, dir, u, tc, &buf); err != nil {
+		return nil, err
+	}
+	prog := filepath.Join(dir, ".goplay", "a.out")
+	if err := build(ctx, dir, modes["run"], u, tc, prog, &buf); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+		resp.Errors = buildErrors(buf.String(), dir)
+		return resp, nil
+	}
+	if vet {
+		buf.Reset()
+		err := check(ctx, dir, modes["vet"], u, tc, &buf)
+		resp.VetErrors = buildErrors(buf.String(), dir)
+		resp.VetOK = err == nil
+	}
+
+	cmd, err := command(dir, workDir, prog, modes["run"])
+	if err != nil {
+		return nil, err
+	}
+	// The program is stopped once its output reaches maxPlayback.
+	progCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	events := &eventLog{full: stop}
+	cmd.Stdout = events.writer("stdout")
+	cmd.Stderr = events.writer("stderr")
+	var pb *playback
+	if *faketimeFlag {
+		pb = &playback{full: stop}
+		cmd.Stdout = pb.writer("stdout")
+		cmd.Stderr = pb.writer("stderr")
+	}
+	err = runCmd(progCtx, cmd)
+	resp.Events = events.events
+	if pb != nil {
+		resp.Events = pb.serverEvents()
+	}
+	switch err := err.(type) {
+	case nil:
+	case *exec.ExitError:
+		resp.Status = err.ExitCode()
+	default:
+		if ctx.Err() == context.DeadlineExceeded {
+			resp.Errors = "process took too long"
+			break
+		}
+		if progCtx.Err() != nil && ctx.Err() == nil {
+			resp.Errors = errTooMuchOutput.Error()
+			break
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// buildErrors tidies the output of the go command for the client: it
+// drops the package headers and the playground directory.
+func buildErrors(out, dir string) string {
+	var lines []string
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if !strings.HasPrefix(line, "# ") {
+			lines = append(lines, strings.Replace(line, dir+"/", "", -1))
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// An eventLog records the output of a program as events, up to
+// maxPlayback bytes.
+type eventLog struct {
+	full func() // if set, called once maxPlayback is reached
+
+	mu        sync.Mutex
+	events    []event
+	size      int
+	truncated bool
+}
+
+// writer returns a writer adding its writes to l as events of the
+// given kind.
+func (l *eventLog) writer(kind string) io.Writer {
+	return eventWriter{l, kind}
+}
+
+type eventWriter struct {
+	log  *eventLog
+	kind string
+}
+
+func (w eventWriter) Write(p []byte) (int, error) {
+	l := w.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size+len(p) > maxPlayback {
+		if !l.truncated && l.full != nil {
+			l.full()
+		}
+		l.truncated = true
+		return len(p), nil
+	}
+	l.size += len(p)
+	if n := len(l.events); n > 0 && l.events[n-1].Kind == w.kind {
+		l.events[n-1].Message += string(p)
+	} else {
+		l.events = append(l.events, event{Message: string(p), Kind: w.kind})
+	}
+	return len(p), nil
+}
+
+// handleFmt formats the Go files in the form value body, which may be
+// in the txtar format, and fixes their imports if imports is true.
+func handleFmt(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	src, ok := formBody(w, r)
+	if !ok {
+		return
+	}
+	body, err := formatSource("a.go", []byte(src), r.FormValue("imports") == "true")
+	if err != nil {
+		writeJSON(w, &fmtResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, &fmtResponse{Body: string(body)})
+}
+
+// sharesDir returns the directory holding the shared snippets.
+func sharesDir() (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".shares"), nil
+}
+
+// snippetID returns the ID under which src is shared.
+func snippetID(src []byte) string {
+	h := sha256.Sum256(src)
+	return base64.URLEncoding.EncodeToString(h[:])[:10]
+}
+
+// handleShare stores the request body and replies with its ID.
+func handleShare(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	src, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSnippetSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	dir, err := sharesDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0700)
+	}
+	id := snippetID(src)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, id+".go"), src, 0600)
+	}
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot store snippet", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, id)
+}
+
+var snippetPath = regexp.MustCompile(`^/p/([A-Za-z0-9_-]+)\.go$`)
+
+// handleSnippet serves the shared snippet /p/ID.go.
+func handleSnippet(w http.ResponseWriter, r *http.Request) {
+	if allowCORS(w, r) {
+		return
+	}
+	m := snippetPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	dir, err := sharesDir()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	src, err := ioutil.ReadFile(filepath.Join(dir, m[1]+".go"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(src)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var checkAddrTests = []struct {
+	addr    string
+	sandbox bool
+	ok      bool
+}{
+	{":8080", false, false},
+	{":8080", true, true},
+	{"localhost:8080", false, true},
+	{"127.0.0.1:8080", false, true},
+	{"[::1]:8080", false, true},
+	{"0.0.0.0:8080", false, false},
+	{"0.0.0.0:8080", true, true},
+	{"192.168.1.2:8080", false, false},
+	{"example.com:8080", false, false},
+	{"example.com:8080", true, true},
+	{"8080", true, false},
+}
+
+func TestCheckAddr(t *testing.T) {
+	for _, tt := range checkAddrTests {
+		if err := checkAddr(tt.addr, tt.sandbox); (err == nil) != tt.ok {
+			t.Errorf("checkAddr(%q, %v) = %v; expected ok to be %v", tt.addr, tt.sandbox, err, tt.ok)
+		}
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	full := 0
+	l := &eventLog{full: func() { full++ }}
+	out, errs := l.writer("stdout"), l.writer("stderr")
+	out.Write([]byte("a"))
+	out.Write([]byte("b"))
+	errs.Write([]byte("c"))
+	out.Write([]byte("d"))
+	want := []event{{"ab", "stdout", 0}, {"c", "stderr", 0}, {"d", "stdout", 0}}
+	if !reflect.DeepEqual(l.events, want) {
+		t.Errorf("events are %q; expected %q", l.events, want)
+	}
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < maxPlayback/len(line)+10; i++ {
+		out.Write(line)
+	}
+	if full != 1 {
+		t.Errorf("full called %d times; expected 1", full)
+	}
+	if n := len(l.events[len(l.events)-1].Message); n > maxPlayback {
+		t.Errorf("event log kept %d bytes; expected at most %d", n, maxPlayback)
+	}
+}
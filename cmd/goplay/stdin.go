@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// stdinFile is the file, relative to the playground, keeping the
+// standard input of the last run, so that it comes back when a
+// session is resumed.
+const stdinFile = ".goplay/stdin"
+
+// An input is the +goplay.stdin window, whose body is the standard
+// input of the programs run in a playground. Until the window is
+// opened, the standard input is stdinFile.
+type input struct {
+	dir string // playground directory
+
+	mu      sync.Mutex
+	win     *acme.Win
+	deleted bool // the window was deleted
+}
+
+func newInput(dir string) *input {
+	return &input{dir: dir}
+}
+
+// open creates the window, holding the standard input of the last
+// run, if any.
+func (in *input) open() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	data, err := ioutil.ReadFile(filepath.Join(in.dir, stdinFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	win, err := acme.New()
+	if err != nil {
+		return err
+	}
+	win.Name("%s", filepath.Join(in.dir, "+goplay.stdin"))
+	win.Write("body", data)
+	win.Ctl("clean")
+	in.win = win
+	return nil
+}
+
+// close deletes the window.
+func (in *input) close() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.win != nil {
+		in.win.Ctl("delete")
+		in.win.CloseFiles()
+		in.win = nil
+	}
+}
+
+// read returns the body of the window, and saves it for the next
+// session. Once the window has been deleted, the standard input is
+// empty.
+func (in *input) read() []byte {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.deleted {
+		return nil
+	}
+	file := filepath.Join(in.dir, stdinFile)
+	if in.win == nil {
+		data, _ := ioutil.ReadFile(file)
+		return data
+	}
+	data, err := in.win.ReadAll("body")
+	if err != nil {
+		in.win.CloseFiles()
+		in.win = nil
+		in.deleted = true
+		return nil
+	}
+	in.win.Ctl("clean")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+		ioutil.WriteFile(file, data, 0600)
+	}
+	return data
+}
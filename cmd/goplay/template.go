@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A template is a starting point for a playground.
+type template struct {
+	files map[string]string // contents by file name
+	mode  string            // how the playground is run
+}
+
+// templates are the built-in templates.
+var templates = map[string]*template{
+	"hello": {
+		files: map[string]string{"a.go": HelloProg},
+		mode:  "run",
+	},
+	"test": {
+		files: map[string]string{
+			"a.go": `package main
+
+func Reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func main() {}
+`,
+			"a_test.go": `package main
+
+import "testing"
+
+func TestReverse(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"abc", "cba"},
+		{"Hello, 世界", "界世 ,olleH"},
+	}
+	for _, tt := range tests {
+		if got := Reverse(tt.in); got != tt.want {
+			t.Errorf("Reverse(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+`,
+		},
+		mode: "test",
+	},
+	"benchmark": {
+		files: map[string]string{
+			"a.go": `package main
+
+import "strings"
+
+func Join(a []string) string {
+	return strings.Join(a, ",")
+}
+
+func Concat(a []string) string {
+	s := ""
+	for i, x := range a {
+		if i > 0 {
+			s += ","
+		}
+		s += x
+	}
+	return s
+}
+
+func main() {}
+`,
+			"a_test.go": `package main
+
+import "testing"
+
+var words = []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+
+func BenchmarkJoin(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Join(words)
+	}
+}
+
+func BenchmarkConcat(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Concat(words)
+	}
+}
+`,
+		},
+		mode: "bench",
+	},
+	"http": {
+		files: map[string]string{
+			"a.go": `package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func main() {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello, %s\n", r.URL.Path)
+	})
+	log.Println("listening on localhost:8080")
+	log.Fatal(http.ListenAndServe("localhost:8080", nil))
+}
+`,
+		},
+		mode: "run",
+	},
+	"generics": {
+		files: map[string]string{
+			"a.go": `package main
+
+import "fmt"
+
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+func Sum[T Number](s []T) T {
+	var sum T
+	for _, v := range s {
+		sum += v
+	}
+	return sum
+}
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	r := make([]U, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func main() {
+	ints := []int{1, 2, 3}
+	fmt.Println(Sum(ints))
+	fmt.Println(Sum(Map(ints, func(i int) float64 { return float64(i) / 2 })))
+}
+`,
+		},
+		mode: "run",
+	},
+}
+
+// modeFile is the file of a playground, or of a user template, naming
+// how it is run.
+const modeFile = ".goplay/mode"
+
+// templatesDir returns the directory holding the user's templates:
+// $XDG_CONFIG_HOME/goplay/templates, or ~/.config/goplay/templates.
+func templatesDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goplay", "templates"), nil
+}
+
+// findTemplate returns the named template. User templates are
+// directories of files copied into the playground, which may include
+// a .goplay/mode file; they take precedence over the built-in ones.
+func findTemplate(name string) (*template, error) {
+	if dir, err := templatesDir(); err == nil && name != "" && !strings.ContainsAny(name, `/\`) {
+		t, err := readTemplate(filepath.Join(dir, name))
+		if err == nil || !os.IsNotExist(err) {
+			return t, err
+		}
+	}
+	if t := templates[name]; t != nil {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown template %q; known templates are %s", name, strings.Join(templateNames(), ", "))
+}
+
+func readTemplate(dir string) (*template, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	t := &template{files: make(map[string]string), mode: "run"}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if filepath.ToSlash(rel) == modeFile {
+			t.mode = strings.TrimSpace(string(data))
+			return nil
+		}
+		t.files[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if modes[t.mode] == nil {
+		return nil, fmt.Errorf("template %s: unknown mode %q", dir, t.mode)
+	}
+	return t, nil
+}
+
+// templateNames returns the names of the built-in and user templates.
+func templateNames() []string {
+	seen := make(map[string]bool)
+	for name := range templates {
+		seen[name] = true
+	}
+	if dir, err := templatesDir(); err == nil {
+		infos, _ := ioutil.ReadDir(dir)
+		for _, fi := range infos {
+			if fi.IsDir() {
+				seen[fi.Name()] = true
+			}
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// create writes the template's files into the playground dir, along
+// with its mode.
+func (t *template) create(dir string) error {
+	files := map[string]string{modeFile: t.mode + "\n"}
+	for name, data := range t.files {
+		files[name] = data
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMode returns the mode of the playground dir.
+func readMode(dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, modeFile))
+	if err != nil {
+		return "run"
+	}
+	if m := strings.TrimSpace(string(data)); modes[m] != nil {
+		return m
+	}
+	return "run"
+}
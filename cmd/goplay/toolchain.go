@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/version"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A toolchain is a Go toolchain used to build playgrounds.
+type toolchain struct {
+	name  string   // as given by the user
+	gobin string   // go command
+	env   []string // additions to the environment of the go command
+}
+
+// toolchains are the toolchains given by the -go, -gobin and
+// -compare flags. With more than one, programs are run with each.
+var toolchains []*toolchain
+
+// toolchainFor returns the toolchain building the playground.
+func toolchainFor() *toolchain {
+	if len(toolchains) > 0 {
+		return toolchains[0]
+	}
+	return &toolchain{name: "go", gobin: "go"}
+}
+
+// parseToolchain parses a toolchain given as a Go release, such as
+// 1.22.3 or go1.22.3, which the go command downloads if need be
+// (see https://go.dev/doc/toolchain), or as the file name of a go
+// command. A release without a patch number, such as 1.22, is the
+// first one, go1.22.0, since GOTOOLCHAIN=go1.22 names a language
+// version, not a release. Releases before go1.21 cannot be
+// downloaded this way.
+func parseToolchain(spec string) (*toolchain, error) {
+	if strings.ContainsRune(spec, filepath.Separator) {
+		gobin, err := filepath.Abs(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(gobin); err != nil {
+			return nil, err
+		}
+		return &toolchain{name: spec, gobin: gobin, env: []string{"GOTOOLCHAIN=local"}}, nil
+	}
+	v := spec
+	if !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+	if !version.IsValid(v) {
+		return nil, fmt.Errorf("bad Go version %q", spec)
+	}
+	if version.Compare(v, "go1.21") < 0 {
+		return nil, fmt.Errorf("Go version %q is older than go1.21; use -gobin", spec)
+	}
+	if version.Lang(v) == v {
+		v += ".0"
+	}
+	return &toolchain{name: v, gobin: "go", env: []string{"GOTOOLCHAIN=" + v}}, nil
+}
+
+// command returns the command running the go command of tc.
+func (tc *toolchain) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(tc.gobin, args...)
+	if len(tc.env) > 0 {
+		cmd.Env = append(os.Environ(), tc.env...)
+	}
+	return cmd
+}
+
+// version returns the Go version of tc, such as go1.22.3.
+func (tc *toolchain) version() (string, error) {
+	out, err := tc.command("env", "GOVERSION").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", tc.name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// setGoVersion sets the go directive of the playground dir's go.mod
+// to the language version of the oldest toolchain, so that they can
+// all build it.
+func setGoVersion(dir string, tcs []*toolchain) error {
+	oldest := ""
+	for _, tc := range tcs {
+		v, err := tc.version()
+		if err != nil {
+			return err
+		}
+		if oldest == "" || version.Compare(v, oldest) < 0 {
+			oldest = v
+		}
+	}
+	lang := strings.TrimPrefix(version.Lang(oldest), "go")
+	cmd := exec.Command("go", "mod", "edit", "-go="+lang)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("setting go version: %v\n%s", err, out)
+	}
+	return nil
+}
+
+// compare runs the playground dir in mode m with each toolchain, with
+// the standard input stdin, and shows the outputs side by side in out.
+// It returns the error of the first toolchain whose run failed, if
+// any.
+func compare(ctx context.Context, dir string, m *mode, stdin []byte, out *output) error {
+	u, err := unpack(dir)
+	if err != nil {
+		out.Printf("[%v]\n", err)
+		return err
+	}
+	out.setUnpacked(u.lines)
+	// The toolchains share go.mod, so its imports are resolved once,
+	// before the runs start.
+	if err := resolve(ctx, dir, u, toolchains[0], out); err != nil {
+		return err
+	}
+
+	heads := make([]string, len(toolchains))
+	cols := make([]string, len(toolchains))
+	errs := make([]error, len(toolchains))
+	var wg sync.WaitGroup
+	for i, tc := range toolchains {
+		heads[i] = tc.name
+		wg.Add(1)
+		go func(i int, tc *toolchain) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			start := time.Now()
+			prog := filepath.Join(dir, ".goplay", fmt.Sprintf("a%d.out", i))
+			work := filepath.Join(workDir, strconv.Itoa(i))
+			errs[i] = runMode(ctx, dir, work, m, u, tc, prog, stdin, &buf)
+			cols[i] = string(out.addrs(buf.Bytes())) + "\n" + status(ctx, errs[i], time.Since(start))
+		}(i, tc)
+	}
+	wg.Wait()
+	out.Printf("%s", sideBySide(heads, cols))
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxColumn is the width at which columns are wrapped.
+const maxColumn = 60
+
+// sideBySide lays out the texts in columns under their heads.
+func sideBySide(heads, texts []string) string {
+	cols := make([][]string, len(texts))
+	widths := make([]int, len(texts))
+	rows := 0
+	for i, text := range texts {
+		lines := []string{heads[i], ""}
+		for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+			lines = append(lines, wrapLine(strings.Replace(line, "\t", "        ", -1), maxColumn)...)
+		}
+		for _, line := range lines {
+			if n := utf8.RuneCountInString(line); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		lines[1] = strings.Repeat("-", widths[i])
+		cols[i] = lines
+		if len(lines) > rows {
+			rows = len(lines)
+		}
+	}
+
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		var row []string
+		for i, col := range cols {
+			cell := ""
+			if r < len(col) {
+				cell = col[r]
+			}
+			if i < len(cols)-1 {
+				cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			}
+			row = append(row, cell)
+		}
+		b.WriteString(strings.TrimRight(strings.Join(row, " | "), " ") + "\n")
+	}
+	return b.String()
+}
+
+// wrapLine splits line into pieces at most width runes long.
+func wrapLine(line string, width int) []string {
+	var lines []string
+	r := []rune(line)
+	for len(r) > width {
+		lines = append(lines, string(r[:width]))
+		r = r[width:]
+	}
+	return append(lines, string(r))
+}
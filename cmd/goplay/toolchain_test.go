@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseToolchainTests = []struct {
+	spec string
+	name string // "" if spec is bad
+}{
+	{"1.22.3", "go1.22.3"},
+	{"go1.22.3", "go1.22.3"},
+	{"1.22", "go1.22.0"},
+	{"go1.21", "go1.21.0"},
+	{"1.23rc1", "go1.23rc1"},
+	{"1.20.14", ""},
+	{"1.20", ""},
+	{"go", ""},
+	{"latest", ""},
+	{"1.22.x", ""},
+	{"/nonexistent/bin/go", ""},
+}
+
+func TestParseToolchain(t *testing.T) {
+	for _, tt := range parseToolchainTests {
+		tc, err := parseToolchain(tt.spec)
+		if tt.name == "" {
+			if err == nil {
+				t.Errorf("parseToolchain(%q) = %q; expected an error", tt.spec, tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseToolchain(%q): %v", tt.spec, err)
+			continue
+		}
+		env := []string{"GOTOOLCHAIN=" + tt.name}
+		if tc.name != tt.name || tc.gobin != "go" || !reflect.DeepEqual(tc.env, env) {
+			t.Errorf("parseToolchain(%q) = %+v; expected name %q and env %q", tt.spec, *tc, tt.name, env)
+		}
+	}
+}
+
+var wrapLineTests = []struct {
+	in  string
+	out []string
+}{
+	{"", []string{""}},
+	{"abc", []string{"abc"}},
+	{"abcd", []string{"abcd"}},
+	{"abcde", []string{"abcd", "e"}},
+	{"abcdefghi", []string{"abcd", "efgh", "i"}},
+	{"αβγδεζ", []string{"αβγδ", "εζ"}},
+}
+
+func TestWrapLine(t *testing.T) {
+	for _, tt := range wrapLineTests {
+		if out := wrapLine(tt.in, 4); !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("wrapLine(%q, 4) = %q; expected %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+var sideBySideTests = []struct {
+	heads, texts []string
+	out          string
+}{
+	{
+		[]string{"go1.21.0", "go1.22.0"},
+		[]string{"0\n1\n", "1\n0\n"},
+		"go1.21.0 | go1.22.0\n" +
+			"-------- | --------\n" +
+			"0        | 1\n" +
+			"1        | 0\n",
+	},
+	{
+		[]string{"a", "b"},
+		[]string{"one\nthree\n", "two\n"},
+		"a     | b\n" +
+			"----- | ---\n" +
+			"one   | two\n" +
+			"three |\n",
+	},
+	{
+		[]string{"a", "b"},
+		[]string{"\tx", "é"},
+		"a         | b\n" +
+			"--------- | -\n" +
+			"        x | é\n",
+	},
+}
+
+func TestSideBySide(t *testing.T) {
+	for _, tt := range sideBySideTests {
+		if out := sideBySide(tt.heads, tt.texts); out != tt.out {
+			t.Errorf("sideBySide(%q, %q) =\n%s\nexpected\n%s", tt.heads, tt.texts, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/txtar"
+)
+
+// unpackedFile lists the files unpacked from the playground's txtar
+// archive by the previous run, one per line.
+const unpackedFile = ".goplay/unpacked"
+
+// An unpacked describes the result of unpacking a playground.
+type unpacked struct {
+	overlay string         // overlay file for go build -overlay, if any
+	lines   map[string]int // for unpacked files, line of their header in a.go
+}
+
+// unpack reads the main file of the playground dir, a.go, as a txtar
+// archive, like the ones of play.golang.org. The leading comment is the
+// main file itself, and each file that follows is written into dir,
+// replacing what was there. Files unpacked by the previous run but no
+// longer in the archive are removed. If a.go holds any files, the
+// returned overlay replaces it with its leading comment for the build.
+func unpack(dir string) (*unpacked, error) {
+	main := filepath.Join(dir, "a.go")
+	data, err := ioutil.ReadFile(main)
+	if err != nil {
+		return nil, err
+	}
+	ar := txtar.Parse(data)
+	u := &unpacked{lines: make(map[string]int)}
+
+	line := 1 + bytes.Count(ar.Comment, []byte("\n"))
+	names := make(map[string]bool)
+	for _, f := range ar.Files {
+		name := filepath.Clean(filepath.FromSlash(f.Name))
+		if !validUnpackName(name) {
+			return nil, fmt.Errorf("a.go:%d: bad file name %q", line, f.Name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("a.go:%d: duplicate file %q", line, f.Name)
+		}
+		names[name] = true
+		u.lines[filepath.ToSlash(name)] = line
+		line += 1 + bytes.Count(f.Data, []byte("\n"))
+
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		// Leave unchanged files alone, for the go command's cache
+		// and for watchers of the playground.
+		if old, err := ioutil.ReadFile(file); err == nil && bytes.Equal(old, f.Data) {
+			continue
+		}
+		if err := ioutil.WriteFile(file, f.Data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := removeStale(dir, names); err != nil {
+		return nil, err
+	}
+	if len(ar.Files) == 0 {
+		return u, nil
+	}
+
+	// The overlay replaces a.go with the program it holds.
+	prog := filepath.Join(dir, ".goplay", "a.go")
+	if err := ioutil.WriteFile(prog, ar.Comment, 0600); err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(struct{ Replace map[string]string }{
+		map[string]string{main: prog},
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.overlay = filepath.Join(dir, ".goplay", "overlay.json")
+	if err := ioutil.WriteFile(u.overlay, js, 0600); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// validUnpackName reports whether name, cleaned, may be unpacked:
+// it must stay within the playground, and not replace a.go or
+// goplay's own files.
+func validUnpackName(name string) bool {
+	slash := filepath.ToSlash(name)
+	switch {
+	case name == "." || filepath.IsAbs(name) || slash == ".." || strings.HasPrefix(slash, "../"):
+		return false
+	case slash == "a.go" || slash == ".goplay" || strings.HasPrefix(slash, ".goplay/"):
+		return false
+	}
+	return true
+}
+
+// removeStale removes the files unpacked by the previous run that are
+// not in names, and records names as the unpacked files. A removed
+// go.mod is created afresh.
+func removeStale(dir string, names map[string]bool) error {
+	record := filepath.Join(dir, unpackedFile)
+	old, err := ioutil.ReadFile(record)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, name := range strings.Split(string(old), "\n") {
+		if name == "" || names[name] {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Remove directories left empty, up to dir.
+		for d := filepath.Dir(file); d != dir && os.Remove(d) == nil; d = filepath.Dir(d) {
+		}
+		if name == "go.mod" {
+			modInit(dir)
+		}
+	}
+
+	var list []string
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	if err := os.MkdirAll(filepath.Dir(record), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(record, []byte(strings.Join(list, "\n")), 0600)
+}
+
+// unpackedNames returns the names, with slashes, of the files unpacked
+// into the playground dir by the previous run.
+func unpackedNames(dir string) map[string]bool {
+	data, _ := ioutil.ReadFile(filepath.Join(dir, unpackedFile))
+	names := make(map[string]bool)
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var validUnpackNameTests = []struct {
+	name string
+	ok   bool
+}{
+	{"b.go", true},
+	{"go.mod", true},
+	{"sub/c.go", true},
+	{"..b.go", true},
+	{"a.go", false},
+	{".goplay", false},
+	{".goplay/a.out", false},
+	{"..", false},
+	{"../b.go", false},
+	{"sub/../../b.go", false},
+	{"/etc/passwd", false},
+	{".", false},
+}
+
+func TestValidUnpackName(t *testing.T) {
+	for _, tt := range validUnpackNameTests {
+		if ok := validUnpackName(filepath.Clean(tt.name)); ok != tt.ok {
+			t.Errorf("validUnpackName(%q) = %v; expected %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+var unpackErrorTests = []struct {
+	src, err string
+}{
+	{"package main\n-- ../b.go --\npackage main\n", `a.go:2: bad file name "../b.go"`},
+	{"package main\n-- /tmp/b.go --\n", `a.go:2: bad file name "/tmp/b.go"`},
+	{"package main\n-- .goplay/a.out --\n", `a.go:2: bad file name ".goplay/a.out"`},
+	{"package main\n-- a.go --\n", `a.go:2: bad file name "a.go"`},
+	{"package main\n-- b.go --\npackage main\n-- ./b.go --\n", `a.go:4: duplicate file "./b.go"`},
+}
+
+func TestUnpackErrors(t *testing.T) {
+	for _, tt := range unpackErrorTests {
+		dir, err := ioutil.TempDir("", "goplay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(tt.src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unpack(dir); err == nil || err.Error() != tt.err {
+			t.Errorf("unpack(%q) returned error %v; expected %s", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package main\n\nfunc main() { hello() }\n-- b.go --\npackage main\n\nfunc hello() {}\n-- sub/c.go --\npackage sub\n")
+	write("mine.go", "package main\n")
+
+	u, err := unpack(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.overlay == "" {
+		t.Errorf("no overlay for a.go holding files")
+	}
+	if u.lines["b.go"] != 4 || u.lines["sub/c.go"] != 8 {
+		t.Errorf("lines = %v; expected b.go at 4 and sub/c.go at 8", u.lines)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "sub", "c.go")); err != nil || string(data) != "package sub\n" {
+		t.Errorf("sub/c.go = %q, %v", data, err)
+	}
+
+	// Files no longer in a.go are removed, with their directories,
+	// and other files are left alone.
+	write("a.go", "package main\n\nfunc main() { hello() }\n-- b.go --\npackage main\n\nfunc hello() {}\n")
+	if _, err := unpack(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"b.go": true, "mine.go": true, "sub/c.go": false, "sub": false} {
+		if got := exists(filepath.Join(dir, name)); got != want {
+			t.Errorf("after removing sub/c.go from a.go, %s exists is %v; expected %v", name, got, want)
+		}
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, unpackedFile)); strings.TrimSpace(string(data)) != "b.go" {
+		t.Errorf("unpacked files are %q; expected b.go", data)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchMask selects the inotify events watched: files written and
+// closed, files renamed into place, as editors often save, and
+// directories created or renamed into place, to be watched too.
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// settle is how long to wait after a write for others to follow, so
+// that saving several files makes a single run.
+const settle = 100 * time.Millisecond
+
+// watch watches the playground dir and its subdirectories with
+// inotify, and starts a run with runs after each write of one of its
+// files, until goplay is interrupted.
+func watch(dir string, runs *runner) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	dirs := make(map[int32]string) // watched directories, by descriptor
+	add := func(root string) error {
+		return filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return err
+			}
+			if name != dir && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			wd, err := syscall.InotifyAddWatch(fd, name, watchMask)
+			if err != nil {
+				return os.NewSyscallError("inotify_add_watch", err)
+			}
+			dirs[int32(wd)] = name
+			return nil
+		})
+	}
+	if err := add(dir); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	written := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				errc <- os.NewSyscallError("read", err)
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				off += syscall.SizeofInotifyEvent
+				name := string(bytes.TrimRight(buf[off:off+int(ev.Len)], "\x00"))
+				off += int(ev.Len)
+
+				d, ok := dirs[ev.Wd]
+				switch {
+				case ev.Mask&syscall.IN_IGNORED != 0:
+					delete(dirs, ev.Wd)
+				case !ok || name == "":
+				case ev.Mask&syscall.IN_ISDIR != 0:
+					if ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+						if err := add(filepath.Join(d, name)); err != nil {
+							fmt.Fprintf(os.Stderr, "goplay: %v\n", err)
+						}
+					}
+				case ev.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+					if file := filepath.Join(d, name); triggers(dir, file) {
+						written <- file
+					}
+				}
+			}
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	var timer <-chan time.Time
+	var last string
+	for {
+		select {
+		case last = <-written:
+			timer = time.After(settle)
+		case <-timer:
+			timer = nil
+			runs.start(0, last, "")
+		case err := <-errc:
+			return err
+		case <-sig:
+			return nil
+		}
+	}
+}
+
+// triggers reports whether writing the named file of the playground
+// dir starts a run. Hidden files, editor backups and the files written
+// by goplay itself, namely go.mod, go.sum and the files unpacked from
+// a.go, do not.
+func triggers(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	base := filepath.Base(name)
+	switch {
+	case strings.HasPrefix(rel, ".") || strings.Contains(rel, "/."):
+		return false
+	case strings.HasPrefix(base, "#") || strings.HasSuffix(base, "~") || base == "4913": // vim's test file
+		return false
+	case rel == "go.mod" || rel == "go.sum":
+		return false
+	}
+	return !unpackedNames(dir)[rel]
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var triggersTests = []struct {
+	name string
+	want bool
+}{
+	{"a.go", true},
+	{"b.go", true},
+	{"sub/b.go", true},
+	{"testdata/in.txt", true},
+	{".a.go.swp", false},
+	{".goplay/run/out", false},
+	{"sub/.hidden/b.go", false},
+	{"a.go~", false},
+	{"#a.go#", false},
+	{"4913", false},
+	{"go.mod", false},
+	{"go.sum", false},
+	{"sub/go.mod", true},
+	{"c.go", false},
+	{"sub/d.go", false},
+}
+
+func TestTriggers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, ".goplay"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, unpackedFile), []byte("c.go\nsub/d.go"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range triggersTests {
+		if got := triggers(dir, filepath.Join(dir, tt.name)); got != tt.want {
+			t.Errorf("triggers(%q) = %v; expected %v", tt.name, got, tt.want)
+		}
+	}
+}
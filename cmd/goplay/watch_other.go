@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func watch(dir string, runs *runner) error {
+	return fmt.Errorf("watching not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// tagCommands are the commands added to the tag of the windows of the
+// playground's Go files, each running the playground in a mode.
+var tagCommands = map[string]string{
+	"Run":         "run",
+	"Test":        "test",
+	"Vet":         "vet",
+	"Staticcheck": "staticcheck",
+	"Race":        "race",
+	"Cover":       "cover",
+	"Bench":       "bench",
+}
+
+const tagText = " Run Test Vet Staticcheck Race Cover Bench History"
+
+// A playWindow is the acme window of a Go file of the playground.
+type playWindow struct {
+	win  *acme.Win
+	runs *runner
+	id   int
+	name string
+}
+
+// attach adds the mode and history commands to the tag of window id,
+// showing the named file, and handles them until the window is
+// deleted.
+func attach(id int, name string, runs *runner) {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer w.CloseFiles()
+	tag, err := w.ReadAll("tag")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if !strings.Contains(string(tag), tagText) {
+		w.Fprintf("tag", "%s", tagText)
+	}
+	w.EventLoop(&playWindow{win: w, runs: runs, id: id, name: name})
+}
+
+func (p *playWindow) Execute(cmd string) bool {
+	if m, ok := tagCommands[cmd]; ok {
+		p.runs.exec(p.id, p.name, m)
+		return true
+	}
+	verb, arg := cmd, ""
+	if i := strings.IndexAny(cmd, " \t"); i >= 0 {
+		verb, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	dir := p.runs.dir
+	var err error
+	switch verb {
+	default:
+		return false
+	case "History":
+		var text []byte
+		if text, err = history(dir); err == nil {
+			err = show(filepath.Join(dir, "+history"), text)
+		}
+	case "Diff":
+		var text []byte
+		if text, err = diffRuns(dir, arg); err == nil {
+			err = show(filepath.Join(dir, "+diff"), text)
+		}
+	case "Restore":
+		err = p.restore(arg)
+	}
+	if err != nil {
+		p.win.Errf("%v", err)
+	}
+	return true
+}
+
+// restore replaces the body of the window with the file as it was in
+// the run given by arg, leaving it to be put.
+func (p *playWindow) restore(arg string) error {
+	data, err := savedFile(p.runs.dir, p.name, arg)
+	if err != nil {
+		return err
+	}
+	if err := p.win.Addr(","); err != nil {
+		return err
+	}
+	if _, err := p.win.Write("data", data); err != nil {
+		return err
+	}
+	p.win.Addr("#0")
+	p.win.Ctl("dot=addr")
+	return p.win.Ctl("show")
+}
+
+func (p *playWindow) Look(arg string) bool { return false }
+
+// show shows text in the window with the given name, creating it if
+// there is none, and replacing its contents otherwise.
+func show(name string, text []byte) error {
+	var w *acme.Win
+	ws, err := acme.Windows()
+	if err != nil {
+		return err
+	}
+	for _, info := range ws {
+		if info.Name == name {
+			if w, err = acme.Open(info.ID, nil); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if w == nil {
+		if w, err = acme.New(); err != nil {
+			return err
+		}
+		w.Name("%s", name)
+	}
+	defer w.CloseFiles()
+	w.Clear()
+	w.Write("body", text)
+	w.Ctl("clean")
+	w.Addr("#0")
+	w.Ctl("dot=addr")
+	return w.Ctl("show")
+}